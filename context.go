@@ -1,71 +1,111 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"mime/multipart"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/schema"
 	"gorm.io/gorm"
 )
 
 type (
 	// Context context
 	Context struct {
-		handlers map[string]ContextFunc
-		result   interface{}
-		Router   *mux.Router
-		Writer   http.ResponseWriter
-		Request  *http.Request
-		Vars     map[string]string // Vars
+		handlers  map[string]ContextFunc
+		result    interface{}
+		lifecycle *lifecycle
+		stream    *EventStream
+		Router    *mux.Router
+		Writer    http.ResponseWriter
+		Request   *http.Request
+		Vars      map[string]string // Vars
 	}
 
 	// ContextFunc func, this func implement http.Handler
 	ContextFunc func(*Context) interface{}
 )
 
-// New create new Context
+// New create new Context. Recover middleware is always
+// the first one of the chain.
 func New(middlewares ...mux.MiddlewareFunc) *Context {
 	var h = new(Context)
 
 	h.Router = NewRouter()
+	h.Router.Use(Recover)
 	if len(middlewares) > 0 {
 		h.Router.Use(middlewares...)
 	}
 
 	h.handlers = make(map[string]ContextFunc)
+	h.lifecycle = newLifecycle()
 	return h
 }
 
-// DB returns database instance
+// DB returns database instance bound to the request context,
+// queries are cancelled when the client disconnects
 func (c *Context) DB(alias string) (*gorm.DB, error) {
-	return GetGormDB(alias)
+	var (
+		err error
+		db  *gorm.DB
+	)
+
+	if db, err = GetGormDB(alias); err != nil {
+		return nil, err
+	}
+	return db.WithContext(c.requestContext()), nil
 }
 
-// Redis returns database instance
+// Redis returns redis client bound to the request context
 func (c *Context) Redis(alias string) (*redis.Client, error) {
-	return GetRedis(alias)
+	var (
+		err    error
+		client *redis.Client
+	)
+
+	if client, err = GetRedis(alias); err != nil {
+		return nil, err
+	}
+	return client.WithContext(c.requestContext()), nil
 }
 
-// Use sets middlewares chain within context Router
-func (c *Context) Use(middlewares ...mux.MiddlewareFunc) {
-	if len(middlewares) > 0 {
-		c.Router.Use(middlewares...)
+// requestContext returns context of Request or
+// context.Background if there is no request
+func (c *Context) requestContext() context.Context {
+	if c.Request == nil {
+		return context.Background()
 	}
+	return c.Request.Context()
+}
+
+// Deadline implements context.Context Deadline
+func (c *Context) Deadline() (time.Time, bool) {
+	return c.requestContext().Deadline()
+}
+
+// Done implements context.Context Done
+func (c *Context) Done() <-chan struct{} {
+	return c.requestContext().Done()
+}
+
+// Err implements context.Context Err
+func (c *Context) Err() error {
+	return c.requestContext().Err()
 }
 
-// Serve call http.ListenAndServe with default setting
-func (c *Context) Serve(port int) error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), c.Router)
+// Value implements context.Context Value
+func (c *Context) Value(key interface{}) interface{} {
+	return c.requestContext().Value(key)
 }
 
-// ServeWith call http.ListenAndServe with default negroni classic middleware
-func (c *Context) ServeWith(port int, router http.Handler) error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+// Use sets middlewares chain within context Router
+func (c *Context) Use(middlewares ...mux.MiddlewareFunc) {
+	if len(middlewares) > 0 {
+		c.Router.Use(middlewares...)
+	}
 }
 
 // HandlerFunc execute request chain
@@ -76,11 +116,16 @@ func (f ContextFunc) HandlerFunc(w http.ResponseWriter, r *http.Request) interfa
 	// ctx.Vars = mux.Vars(r)
 	ctx.result = f(&ctx)
 
+	// stop event stream before the writer is released
+	if ctx.stream != nil {
+		ctx.stream.Close()
+	}
+
 	switch ctx.result.(type) {
 	case error, Error, *Error:
-		fmt.Printf("[go-handler] error: %+v\n", ctx.result)
+		fmt.Printf("[go-handler] error: %+v (status %d, %d bytes)\n", ctx.result, ctx.Status(), ctx.Size())
 	default:
-		fmt.Println("[go-handler] info: request complete")
+		fmt.Printf("[go-handler] info: request complete (status %d, %d bytes)\n", ctx.Status(), ctx.Size())
 	}
 
 	return ctx.result
@@ -97,23 +142,25 @@ func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
 	c.setRequest(r)
 }
 
-func (c *Context) add(method, path string, ctx ContextFunc, middlewares []mux.MiddlewareFunc) {
-	c.Router.Use(middlewares...)
+func (c *Context) add(method, path string, ctx ContextFunc, middlewares []mux.MiddlewareFunc) http.Handler {
 	c.handlers[method+path] = ctx
+	return chain(c.handlers[method+path], middlewares)
 }
 
 func (c *Context) addRoute(method, path string, ctx ContextFunc, middlewares []mux.MiddlewareFunc) {
-	c.add(method, path, ctx, middlewares)
-	c.Router.Handle(path, c.handlers[method+path]).Methods(method)
+	c.Router.Handle(path, c.add(method, path, ctx, middlewares)).Methods(method)
 }
 
 func (c *Context) addRest(method, path string, ctx ContextFunc, middlewares []mux.MiddlewareFunc) {
-	c.add(method, path, ctx, middlewares)
+	var (
+		sub   *mux.Router
+		route http.Handler
+	)
 
-	var sub *mux.Router
+	route = c.add(method, path, ctx, middlewares)
 	sub = Group(path, c.Router)
-	sub.Handle(index, c.handlers[method+path]).Methods(indexMethods...)
-	sub.Handle(subID, c.handlers[method+path]).Methods(subIDMethods...)
+	sub.Handle(index, route).Methods(indexMethods...)
+	sub.Handle(subID, route).Methods(subIDMethods...)
 }
 
 // SetRequest set http.Request
@@ -121,16 +168,54 @@ func (c *Context) setRequest(r *http.Request) {
 	c.Request = r
 }
 
-// SetWriter set http.ResponseWriter
+// SetWriter set http.ResponseWriter wrapped as ResponseWriter
 func (c *Context) setWriter(w http.ResponseWriter) {
-	c.Writer = w
+	c.Writer = WrapWriter(w)
+}
+
+// Written returns true if the response has already been written
+func (c *Context) Written() bool {
+	if rw, ok := c.Writer.(ResponseWriter); ok {
+		return rw.Written()
+	}
+	return false
 }
 
-// REST map request as http RESTful resource
+// Status returns the written status code or 0
+func (c *Context) Status() int {
+	if rw, ok := c.Writer.(ResponseWriter); ok {
+		return rw.Status()
+	}
+	return 0
+}
+
+// Size returns the number of body bytes written
+func (c *Context) Size() int {
+	if rw, ok := c.Writer.(ResponseWriter); ok {
+		return rw.Size()
+	}
+	return 0
+}
+
+// REST map request as http RESTful resource.
+// Middlewares only wrap this resource, see GET.
 func (c *Context) REST(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
 	c.addRest(restful, path, ctx, middlewares)
 }
 
+// RESTFactory map request as http RESTful resource created by factory.
+// factory is called on every request, so concurrent requests never
+// share a resource. Middlewares only wrap this resource, see GET.
+func (c *Context) RESTFactory(path string, factory RestFactory, middlewares ...mux.MiddlewareFunc) {
+	c.REST(path, func(ctx *Context) interface{} {
+		var rest RestHandlers
+		if rest = factory(); rest == nil {
+			return ctx.InternalServerError(nil)
+		}
+		return REST(rest, ctx)
+	}, middlewares...)
+}
+
 // SubRouter create sub router and set ctx
 func (c *Context) SubRouter(path string, middlewares ...mux.MiddlewareFunc) *Context {
 	var (
@@ -143,67 +228,109 @@ func (c *Context) SubRouter(path string, middlewares ...mux.MiddlewareFunc) *Con
 
 	newContext = New()
 	newContext.Router = subRouter
+	newContext.lifecycle = c.getLifecycle()
 	return newContext
 }
 
-// GET handle http GET request
+// GET handle http GET request.
+// Middlewares only wrap this route and run in the given order,
+// after the middlewares of the router (New, Use and SubRouter).
 func (c *Context) GET(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
 	c.addRoute(get, path, ctx, middlewares)
 }
 
-// POST handle http POST request
+// POST handle http POST request.
+// Middlewares only wrap this route, see GET.
 func (c *Context) POST(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
 	c.addRoute(post, path, ctx, middlewares)
 }
 
-// PUT handle http PUT request
+// PUT handle http PUT request.
+// Middlewares only wrap this route, see GET.
 func (c *Context) PUT(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
 	c.addRoute(put, path, ctx, middlewares)
 }
 
-// PATCH handle http PATCH request
+// PATCH handle http PATCH request.
+// Middlewares only wrap this route, see GET.
 func (c *Context) PATCH(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
 	c.addRoute(patch, path, ctx, middlewares)
 }
 
-// DELETE handle http DELETE request
+// DELETE handle http DELETE request.
+// Middlewares only wrap this route, see GET.
 func (c *Context) DELETE(path string, ctx ContextFunc, middlewares ...mux.MiddlewareFunc) {
-	c.addRoute(delete, path, ctx, middlewares)
+	c.addRoute(methodDelete, path, ctx, middlewares)
 }
 
 // FormData parse the incoming POST body into "form" struct
 // handle application/json and application/x-www-form-urlencoded
-// and multipart/form-data
+// and multipart/form-data. Returns decode error if any.
 func (c *Context) FormData(form interface{}) error {
-	var headerContentType string
-	headerContentType = c.Request.Header.Get(contentType)
-
-	if strings.Contains(headerContentType, "application/json") {
-		decoder := json.NewDecoder(c.Request.Body)
-		decoder.Decode(form)
-		return nil
-	} else if strings.Contains(headerContentType, "application/x-www-form-urlencoded") {
-		c.Request.ParseForm()
-		decoder := schema.NewDecoder()
-		decoder.Decode(form, c.Request.Form)
-		return nil
-	} else if strings.Contains(headerContentType, "multipart/form-data") {
-		c.Request.ParseMultipartForm(defaultMaxMemory)
-		decoder := schema.NewDecoder()
-		decoder.Decode(form, c.Request.Form)
-		return nil
-	} else {
-		custError := &Error{
-			Description: invalidContentType,
+	return FormData(form, c.Request)
+}
+
+// NewBindOptions returns default BindOptions,
+// request body is limited to 10MB
+func NewBindOptions() *BindOptions {
+	return &BindOptions{
+		MaxBodySize: defaultMaxMemory,
+	}
+}
+
+// Bind decodes request body into dst with default BindOptions.
+// See BindWith.
+func (c *Context) Bind(dst interface{}) error {
+	return c.BindWith(dst, nil)
+}
+
+// BindWith decodes request body into dst then calls dst.Validate()
+// if dst implements Validator. On failure it sends 400-bad request,
+// or 413-request entity too large if the body exceeds opt.MaxBodySize,
+// and returns the error, so the handler can return it as is:
+//
+//	if err := ctx.Bind(&form); err != nil {
+//		return err
+//	}
+func (c *Context) BindWith(dst interface{}, opt *BindOptions) error {
+	var (
+		err       error
+		ok        bool
+		validator Validator
+	)
+
+	if opt == nil {
+		opt = NewBindOptions()
+	}
+
+	if opt.MaxBodySize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, opt.MaxBodySize)
+	}
+
+	if err = decodeBody(dst, c.Request, opt); err != nil {
+		if opt.MaxBodySize > 0 && exceedsMaxBytes(err) {
+			err = &Error{Description: fmt.Sprintf(bodyTooLarge, opt.MaxBodySize)}
+			c.renderError(http.StatusText(http.StatusRequestEntityTooLarge), err, http.StatusRequestEntityTooLarge)
+			return err
+		}
+		c.BadRequest(err)
+		return err
+	}
+
+	if validator, ok = dst.(Validator); ok {
+		if err = validator.Validate(); err != nil {
+			err = DescError(err)
+			c.BadRequest(err)
+			return err
 		}
-		Logger(custError)
-		return custError
 	}
+
+	return nil
 }
 
 // RequestContextValue return interface value of request context
 func (c *Context) RequestContextValue(key interface{}) interface{} {
-	return c.Request.Context().Value(key)
+	return c.Value(key)
 }
 
 // FormFile returns the first file for the provided form key.
@@ -242,15 +369,7 @@ func (c *Context) PostFormValues(key string) []string {
 // DecodeURLQuery parse the incoming URL query into struct Urlq.
 // Returns true if everyting went well, otherwise false.
 func (c *Context) DecodeURLQuery() (urlQuery URLQuery, err error) {
-	var decoder *schema.Decoder
-	// get url's query
-	decoder = schema.NewDecoder()
-	decoder.Decode(&urlQuery, c.Request.URL.Query())
-	if err = urlQuery.Validate(); err != nil {
-		return urlQuery, DescError(err)
-	}
-
-	return urlQuery, nil
+	return DecodeURLQuery(c.Writer, c.Request.URL.Query())
 }
 
 // Get implements Get() of RestHandlers
@@ -318,25 +437,35 @@ func (c *Context) Delete() interface{} {
 
 // Created send success response with result data
 func (c *Context) Created(data interface{}) interface{} {
-	return response(c.Writer, MessageCreated, data, http.StatusCreated)
+	return response(c.Writer, c.Request, MessageCreated, data, http.StatusCreated)
 }
 
 // Success send success response with result data
 func (c *Context) Success(data interface{}) interface{} {
-	return response(c.Writer, MessageOK, data, http.StatusOK)
+	return response(c.Writer, c.Request, MessageOK, data, http.StatusOK)
 }
 
 // NoContent send success response without any content
 func (c *Context) NoContent() interface{} {
-	return response(c.Writer, MessageNoContent, nil, http.StatusNoContent)
+	return response(c.Writer, c.Request, MessageNoContent, nil, http.StatusNoContent)
 }
 
-// BadRequest send general 400-bad request
+// BadRequest send general 400-bad request.
+// Each failing field is listed if err holds validation.Errors
 func (c *Context) BadRequest(err error) interface{} {
 	if err == nil {
-		return response(c.Writer, MessageBadRequest, errBadRequest, http.StatusBadRequest)
+		return c.renderError(MessageBadRequest, &errBadRequest, http.StatusBadRequest)
+	}
+	return c.renderError(MessageBadRequest, DescError(err), http.StatusBadRequest)
+}
+
+// UnprocessableEntity send general 422-unprocessable entity.
+// Each failing field is listed if err holds validation.Errors
+func (c *Context) UnprocessableEntity(err error) interface{} {
+	if err == nil {
+		return c.renderError(MessageUnprocessableEntity, &errUnprocessableEntity, http.StatusUnprocessableEntity)
 	}
-	return response(c.Writer, MessageBadRequest, err, http.StatusBadRequest)
+	return c.renderError(MessageUnprocessableEntity, DescError(err), http.StatusUnprocessableEntity)
 }
 
 // NotFound send general 404-Not found.
@@ -344,64 +473,60 @@ func (c *Context) BadRequest(err error) interface{} {
 // used when record was not found in collection instead of
 // return a page not found message
 func (c *Context) NotFound() interface{} {
-	return response(c.Writer, MessageNotFound, errNotFound, http.StatusNotFound)
+	return c.renderError(MessageNotFound, &errNotFound, http.StatusNotFound)
 }
 
 // PageNotFound send general 404-not found.
 // this method is equal to NotFound() but returns
 // page not found message
 func (c *Context) PageNotFound() interface{} {
-	return response(c.Writer, MessagePageNotFound, errPageNotFound, http.StatusNotFound)
+	return c.renderError(MessagePageNotFound, &errPageNotFound, http.StatusNotFound)
 }
 
 // InternalServerError send general 500-interal server error
 func (c *Context) InternalServerError(err error) interface{} {
 	if err == nil {
-		return response(c.Writer, MessageInternalServerError, errInternalServerError, http.StatusInternalServerError)
+		return c.renderError(MessageInternalServerError, &errInternalServerError, http.StatusInternalServerError)
 	}
-	return response(c.Writer, MessageInternalServerError, err, http.StatusInternalServerError)
+	return c.renderError(MessageInternalServerError, err, http.StatusInternalServerError)
 }
 
 // Unauthorized send general 401-unautirized
 func (c *Context) Unauthorized(err error) interface{} {
 	if err == nil {
-		return response(c.Writer, MessageUnauthorized, errUnauthorized, http.StatusUnauthorized)
+		return c.renderError(MessageUnauthorized, &errUnauthorized, http.StatusUnauthorized)
 	}
-	return response(c.Writer, MessageUnauthorized, err, http.StatusUnauthorized)
+	return c.renderError(MessageUnauthorized, err, http.StatusUnauthorized)
 }
 
 // Forbidden send general 403-forbidden
 func (c *Context) Forbidden(err error) interface{} {
 	if err == nil {
-		return response(c.Writer, MessageForbidden, errForbidden, http.StatusForbidden)
+		return c.renderError(MessageForbidden, &errForbidden, http.StatusForbidden)
 	}
-	return response(c.Writer, MessageForbidden, err, http.StatusForbidden)
+	return c.renderError(MessageForbidden, err, http.StatusForbidden)
 }
 
 // MethodNotAllowed send general 405-Method not allowed
 func (c *Context) MethodNotAllowed() interface{} {
-	return response(c.Writer, MessageMethodNotAllowed, errNotAllowed, http.StatusMethodNotAllowed)
+	return c.renderError(MessageMethodNotAllowed, &errNotAllowed, http.StatusMethodNotAllowed)
 }
 
 // Conflict send general 409-Conflict
 func (c *Context) Conflict() interface{} {
-	return response(c.Writer, MessageConflict, errConflict, http.StatusConflict)
+	return c.renderError(MessageConflict, &errConflict, http.StatusConflict)
 }
 
 // NotImplemented send general 405-Method not allowed
 func (c *Context) NotImplemented() interface{} {
-	return response(c.Writer, MessageNotImplemented, errNotImplemented, http.StatusNotImplemented)
+	return c.renderError(MessageNotImplemented, &errNotImplemented, http.StatusNotImplemented)
 }
 
-func (c *Context) Write(message string, data interface{}, status int) interface{} {
-	return response(c.Writer, message, data, status)
+// renderError sends err through the current ErrorRenderer
+func (c *Context) renderError(message string, err error, status int) interface{} {
+	return errorRenderer(c.Writer, c.Request, message, err, status)
 }
 
-// SendImage returns image in response body
-func (c *Context) SendImage(path string) interface{} {
-	var err error
-	if err = WriteImage(path, c.Writer); err != nil {
-		return DescError(err)
-	}
-	return "send image: " + path
+func (c *Context) Write(message string, data interface{}, status int) interface{} {
+	return response(c.Writer, c.Request, message, data, status)
 }
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoResource answers with the id and the query of its own request
+type echoResource struct {
+	Context
+}
+
+// GetID implements RestHandlers GetID
+func (r *echoResource) GetID(id string) interface{} {
+	var query string = r.Request.URL.Query().Get("n")
+
+	// let other requests run in between
+	time.Sleep(time.Millisecond)
+
+	return r.Success(map[string]string{"id": id, "n": query, "n2": r.Request.URL.Query().Get("n")})
+}
+
+func TestRESTFactoryConcurrent(t *testing.T) {
+	var (
+		wg       sync.WaitGroup
+		ctx      *Context = New(JSONify)
+		requests int      = 50
+	)
+
+	ctx.RESTFactory("/echo", func() RestHandlers { return &echoResource{} })
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var (
+				w    *httptest.ResponseRecorder = httptest.NewRecorder()
+				body struct {
+					Data map[string]string `json:"data"`
+				}
+				want = map[string]string{"id": fmt.Sprint(i), "n": fmt.Sprint(i), "n2": fmt.Sprint(i)}
+			)
+
+			ctx.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/echo/%d?n=%d", i, i), nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("request %d: status %d, want %d", i, w.Code, http.StatusOK)
+				return
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			for key, value := range want {
+				if body.Data[key] != value {
+					t.Errorf("request %d: %s is %q, want %q", i, key, body.Data[key], value)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// pageCursor is the decoded cursor of cursor pagination, the
+// values of the sort columns and of the primary key of a row
+type pageCursor struct {
+	Values []json.RawMessage `json:"v"`
+	Sort   string            `json:"s,omitempty"`
+	Prev   bool              `json:"p,omitempty"`
+}
+
+// CursorPagination applies keyset pagination of urlQuery.Cursor to db,
+// rows are ordered by the sort of urlQuery then by columns.PrimaryKey.
+// Sort columns should not be nullable. One extra row is fetched to find
+// out if there is another page, call CursorResult after the query to
+// trim it. db must have a Model, total items are counted only if
+// count=true. Filters and sort are validated against columns first, an
+// invalid one or an invalid cursor fails the query with *Error listing
+// them in Fields, see FieldErrors. A cursor is only valid for the sort
+// it was made of.
+//
+//	query := handler.CursorPagination(db.Model(&User{}), urlQuery, columns)
+//	if err := query.Find(&users).Error; err != nil {
+//		return ctx.BadRequest(err)
+//	}
+//	return ctx.Success(handler.CursorResult(query, &users, urlQuery, columns))
+func CursorPagination(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
+	var (
+		err       error
+		total     int64
+		cursor    pageCursor
+		key       sortKey
+		keys      []sortKey
+		values    []interface{}
+		condition string
+	)
+
+	if columns == nil {
+		columns = &FilteredColumn{}
+	}
+
+	// a new instance, the statement of db is never shared
+	db = db.Limit(cursorLimit(urlQuery) + 1)
+
+	if err = validateQuery(urlQuery, columns); err != nil {
+		db.AddError(err)
+		return db
+	}
+
+	db = filterQuery(db, urlQuery, columns)
+	keys, _ = cursorKeys(urlQuery, columns)
+
+	if urlQuery.Count == logicalTrue {
+		if err = db.Session(&gorm.Session{WithConditions: true}).Count(&total).Error; err != nil {
+			db.AddError(err)
+			return db
+		}
+		db = db.Set(cursorTotalKey, total)
+	}
+
+	if urlQuery.Cursor != "" {
+		if cursor, err = parseCursor(urlQuery.Cursor); err == nil {
+			values, err = cursorValues(db, cursor, keys)
+		}
+		if err != nil {
+			db.AddError(DescError(validation.Errors{"cursor": errors.New(invalidCursor)}))
+			return db
+		}
+
+		condition, values = keysetCondition(keys, values, cursor.Prev)
+		db = db.Where(condition, values...)
+	}
+
+	// walk backwards to the previous page
+	for _, key = range keys {
+		db = db.Order(orderClause(db, key, cursor.Prev))
+	}
+	return db
+}
+
+// CursorResult trims the extra row fetched by CursorPagination from
+// resultSet, a pointer to slice, and returns CursorPaginationResult with
+// the cursors of its first and last rows. Rows of a previous page are
+// put back in order.
+func CursorResult(dbResult *gorm.DB, resultSet interface{}, urlQuery URLQuery, columns *FilteredColumn) CursorPaginationResult {
+	var (
+		more    bool
+		hasNext bool
+		hasPrev bool
+		limit   int = cursorLimit(urlQuery)
+		keys    []sortKey
+		list    reflect.Value
+		cursor  pageCursor
+		result  CursorPaginationResult = CursorPaginationResult{
+			List:         []string{},
+			Keyword:      urlQuery.Keyword,
+			ItemsPerPage: limit,
+		}
+	)
+
+	if columns == nil {
+		columns = &FilteredColumn{}
+	}
+
+	result.StartDate, result.EndDate, result.DateRange = resultDates(dbResult)
+
+	if total, ok := dbResult.Get(cursorTotalKey); ok {
+		count := total.(int64)
+		result.TotalItems = &count
+	}
+
+	if list = reflect.ValueOf(resultSet); list.Kind() != reflect.Ptr || list.Elem().Kind() != reflect.Slice {
+		return result
+	}
+	list = list.Elem()
+
+	if urlQuery.Cursor != "" {
+		cursor, _ = parseCursor(urlQuery.Cursor)
+	}
+
+	if more = list.Len() > limit; more {
+		list.Set(list.Slice(0, limit))
+	}
+	if cursor.Prev {
+		swap := reflect.Swapper(list.Interface())
+		for i, j := 0, list.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	hasNext = more || cursor.Prev
+	hasPrev = (cursor.Prev && more) || (!cursor.Prev && urlQuery.Cursor != "")
+
+	// the query has failed on an invalid sort
+	keys, _ = cursorKeys(urlQuery, columns)
+
+	if list.Len() > 0 && len(keys) > 0 {
+		if hasNext {
+			result.NextCursor = encodeCursor(dbResult, list.Index(list.Len()-1), keys, false)
+		}
+		if hasPrev {
+			result.PrevCursor = encodeCursor(dbResult, list.Index(0), keys, true)
+		}
+	}
+
+	result.List = list.Interface()
+	return result
+}
+
+// cursorLimit returns items per page of urlQuery, 10 by default and at most 100
+func cursorLimit(urlQuery URLQuery) int {
+	var limit int = 10
+
+	if len(urlQuery.ItemsPerPage) != 0 {
+		limit, _ = strconv.Atoi(urlQuery.ItemsPerPage)
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return limit
+}
+
+// cursorKeys returns the sort keys of urlQuery followed by the primary
+// key, which takes the direction of the first key
+func cursorKeys(urlQuery URLQuery, columns *FilteredColumn) ([]sortKey, error) {
+	var (
+		err  error
+		keys []sortKey
+		key  sortKey = sortKey{
+			descending: strings.ToLower(urlQuery.Descending) == logicalTrue,
+		}
+	)
+
+	if keys, err = sortKeys(urlQuery, columns); err != nil {
+		return nil, err
+	}
+
+	key.name, key.column = primaryKey(columns), primaryKey(columns)
+	if len(keys) > 0 {
+		key.descending = keys[0].descending
+	}
+	return append(keys, key), nil
+}
+
+// primaryKey returns PrimaryKey of columns, default is "id"
+func primaryKey(columns *FilteredColumn) string {
+	if columns.PrimaryKey == "" {
+		return id
+	}
+	return columns.PrimaryKey
+}
+
+// keysetCondition returns the condition of rows after values of keys,
+// or before them when prev is true, e.g. (a > ? OR (a = ? AND id > ?))
+func keysetCondition(keys []sortKey, values []interface{}, prev bool) (string, []interface{}) {
+	var (
+		operator   string
+		parts      []string
+		conditions []string
+		args       []interface{}
+	)
+
+	for i, key := range keys {
+		parts = parts[:0]
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].column+" = ?")
+			args = append(args, values[j])
+		}
+
+		if operator = ">"; key.descending != prev {
+			operator = "<"
+		}
+		parts = append(parts, key.column+" "+operator+" ?")
+		args = append(args, values[i])
+
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// parseCursor decodes an opaque cursor
+func parseCursor(raw string) (pageCursor, error) {
+	var (
+		err     error
+		data    []byte
+		cursor  pageCursor
+		decoder *json.Decoder
+	)
+
+	if data, err = base64.RawURLEncoding.DecodeString(raw); err != nil {
+		return cursor, err
+	}
+
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&cursor); err != nil {
+		return cursor, err
+	}
+	return cursor, nil
+}
+
+// cursorValues converts values of cursor into the field types of the
+// model so times and numbers are bound with their own type. The cursor
+// must have been made of the same keys.
+func cursorValues(db *gorm.DB, cursor pageCursor, keys []sortKey) ([]interface{}, error) {
+	var (
+		err    error
+		value  interface{}
+		values []interface{}
+	)
+
+	if cursor.Sort != sortString(keys) || len(cursor.Values) != len(keys) {
+		return nil, errors.New(invalidCursor)
+	}
+
+	for i, key := range keys {
+		if value, err = fieldValue(db, key.column, cursor.Values[i]); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// fieldValue decodes raw as the type of column, without
+// schema numbers are kept as json.Number
+func fieldValue(db *gorm.DB, column string, raw json.RawMessage) (interface{}, error) {
+	var (
+		err     error
+		value   interface{}
+		target  reflect.Value
+		field   *schema.Field
+		decoder *json.Decoder
+	)
+
+	if field = cursorField(db, column); field != nil {
+		target = reflect.New(field.FieldType)
+		if err = json.Unmarshal(raw, target.Interface()); err != nil {
+			return nil, err
+		}
+		return target.Elem().Interface(), nil
+	}
+
+	decoder = json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	return value, err
+}
+
+// encodeCursor returns the cursor of row, empty if
+// a key is not a field of the model
+func encodeCursor(db *gorm.DB, row reflect.Value, keys []sortKey, prev bool) string {
+	var (
+		err    error
+		data   []byte
+		value  []byte
+		field  *schema.Field
+		cursor pageCursor = pageCursor{Sort: sortString(keys), Prev: prev}
+	)
+
+	row = indirect(row)
+
+	for _, key := range keys {
+		if field = cursorField(db, key.column); field == nil {
+			return ""
+		}
+		fieldValue, _ := field.ValueOf(row)
+		if value, err = json.Marshal(fieldValue); err != nil {
+			return ""
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+
+	if data, err = json.Marshal(cursor); err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorField returns the model field of column, the
+// table qualifier of column is ignored
+func cursorField(db *gorm.DB, column string) *schema.Field {
+	if db.Statement.Schema == nil {
+		if db.Statement.Model == nil || db.Statement.Parse(db.Statement.Model) != nil {
+			return nil
+		}
+	}
+	return db.Statement.Schema.LookUpField(column[strings.LastIndex(column, ".")+1:])
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var defaultLocation *time.Location = time.UTC
+
+// SetLocation sets the time zone of date ranges when tz is not requested,
+// e.g. SetLocation(time.Local). The default and nil are time.UTC so the
+// range does not depend on the zone of the server.
+func SetLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	defaultLocation = loc
+}
+
+// location returns the time zone of urlQuery
+func location(urlQuery URLQuery) (*time.Location, error) {
+	if urlQuery.TimeZone == "" {
+		return defaultLocation, nil
+	}
+	return time.LoadLocation(urlQuery.TimeZone)
+}
+
+// validTimeZone checks value is a time zone name, e.g. Asia/Jakarta
+func validTimeZone(value interface{}) error {
+	if tz, _ := value.(string); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return errors.New(invalidTimeZone)
+		}
+	}
+	return nil
+}
+
+// dateFilter returns the half-open range [start 00:00, end+1 00:00) of
+// urlQuery in its time zone. A missing end date is the start date, a
+// missing start date is today only if columns.DefaultToday is set,
+// otherwise the range has no lower bound and Start is nil, e.g. only
+// end_date matches every row up to the end of that day. Returns nil
+// if there is no range.
+func dateFilter(urlQuery URLQuery, columns *FilteredColumn) (*DateRange, error) {
+	var (
+		err   error
+		loc   *time.Location
+		start time.Time
+		end   time.Time
+		today bool = columns != nil && columns.DefaultToday
+		dates DateRange
+	)
+
+	if loc, err = location(urlQuery); err != nil {
+		return nil, errors.New(invalidTimeZone)
+	}
+	dates.TimeZone = loc.String()
+
+	if urlQuery.StartDate == "" && urlQuery.EndDate == "" && !today {
+		return nil, nil
+	}
+
+	switch {
+	case urlQuery.StartDate != "":
+		if start, err = time.ParseInLocation(formatDate, urlQuery.StartDate, loc); err != nil {
+			return nil, err
+		}
+		dates.Start = &start
+	case today:
+		now := time.Now().In(loc)
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		dates.Start = &start
+	}
+
+	if urlQuery.EndDate != "" {
+		if end, err = time.ParseInLocation(formatDate, urlQuery.EndDate, loc); err != nil {
+			return nil, err
+		}
+	} else {
+		end = start
+	}
+
+	// the day after in the zone, it is not always 24 hours away
+	end = end.AddDate(0, 0, 1)
+	dates.End = &end
+
+	return &dates, nil
+}
+
+// applyDateFilter adds the date range of urlQuery on columns.DateColumn to
+// db and keeps it for PageResult, an invalid range is added to the errors of db
+func applyDateFilter(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
+	var (
+		err   error
+		dates *DateRange
+	)
+
+	if dates, err = dateFilter(urlQuery, columns); err != nil {
+		db.AddError(DescError(err))
+		return db
+	}
+	if dates == nil {
+		return db
+	}
+
+	// instants are bound in UTC so text columns of sqlite compare as well
+	if dates.Start != nil {
+		db = db.Where(columns.DateColumn+" >= ?", dates.Start.UTC())
+	}
+	return db.Where(columns.DateColumn+" < ?", dates.End.UTC()).Set(dateRangeKey, *dates)
+}
+
+// resultDates returns the date range kept by applyDateFilter,
+// StartDate and EndDate are the inclusive dates of the range
+func resultDates(dbResult *gorm.DB) (*time.Time, *time.Time, *DateRange) {
+	var (
+		ok      bool
+		value   interface{}
+		dates   DateRange
+		endDate time.Time
+	)
+
+	if value, ok = dbResult.Get(dateRangeKey); !ok {
+		return nil, nil, nil
+	}
+
+	dates = value.(DateRange)
+	endDate = dates.End.AddDate(0, 0, -1)
+	return dates.Start, &endDate, &dates
+}
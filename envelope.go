@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// Envelope builds the response payload which wraps data
+	Envelope func(message string, status int, data interface{}, r *http.Request) interface{}
+
+	// envelopeKey is the request context key of Envelope
+	envelopeKey struct{}
+)
+
+var defaultEnvelope Envelope = ResponseEnvelope
+
+// SetEnvelope sets the global envelope of every response.
+// nil restores the default ResponseEnvelope.
+func SetEnvelope(envelope Envelope) {
+	if envelope == nil {
+		envelope = ResponseEnvelope
+	}
+	defaultEnvelope = envelope
+}
+
+// ResponseEnvelope wraps data in the default Response
+func ResponseEnvelope(message string, status int, data interface{}, r *http.Request) interface{} {
+	return Response{Message: message, Data: data}
+}
+
+// NoEnvelope sends data as is
+func NoEnvelope(message string, status int, data interface{}, r *http.Request) interface{} {
+	return data
+}
+
+// SetEnvelope overrides the global envelope for every route,
+// 404 and 405 responses of this router, e.g. a SubRouter
+func (c *Context) SetEnvelope(envelope Envelope) {
+	var middleware mux.MiddlewareFunc = withEnvelope(envelope)
+
+	c.Router.Use(middleware)
+	c.Router.NotFoundHandler = middleware(PageNotFound404{})
+	c.Router.MethodNotAllowedHandler = middleware(MethodNotAllowed405{})
+}
+
+// withEnvelope returns middleware which stores envelope in request context
+func withEnvelope(envelope Envelope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), envelopeKey{}, envelope)))
+		})
+	}
+}
+
+// envelopeOf returns envelope of the request or the global one
+func envelopeOf(r *http.Request) Envelope {
+	if r != nil {
+		if envelope, ok := r.Context().Value(envelopeKey{}).(Envelope); ok && envelope != nil {
+			return envelope
+		}
+	}
+	return defaultEnvelope
+}
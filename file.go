@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SendFile sends file of path inline. Byte ranges, conditional
+// requests (If-None-Match, If-Modified-Since) and HEAD are handled
+// by http.ServeContent. Content-Type is taken from the extension
+// or sniffed from the content.
+func (c *Context) SendFile(path string) interface{} {
+	return c.sendFile(path, "inline", filepath.Base(path))
+}
+
+// Attachment sends file of path as a download named name,
+// an empty name uses the base name of path. See SendFile.
+func (c *Context) Attachment(path, name string) interface{} {
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	return c.sendFile(path, "attachment", name)
+}
+
+// sendImage sends image of path like SendFile. If the file does not
+// exist or is not an image, the image of ERROR_IMAGE env is sent instead.
+func (c *Context) sendImage(path string) interface{} {
+	var (
+		err       error
+		file      *os.File
+		info      os.FileInfo
+		mediaType string
+	)
+
+	if c.Written() {
+		return ErrAlreadyWritten
+	}
+
+	if file, info, mediaType, err = openFile(path); err == nil && !strings.HasPrefix(mediaType, "image/") {
+		file.Close()
+		err = &Error{Description: decodeFail}
+	}
+
+	if err != nil {
+		Logger(DescError(err))
+		return errorImage(c.Writer, c.Request)
+	}
+	defer file.Close()
+
+	setImageHeaders(c.Writer)
+	serveContent(c.Writer, c.Request, file, info, mediaType, "inline", filepath.Base(path))
+	return "send image: " + path
+}
+
+// setImageHeaders sets HSTS and CSP headers of image responses
+func setImageHeaders(w http.ResponseWriter) {
+	w.Header().Set(strictTransportSecurity, "max-age=31536000")
+	w.Header().Set(contentSecurityPolicy, "default-src 'self'")
+}
+
+// sendFile sends file of path with Content-Disposition of disposition and name
+func (c *Context) sendFile(path, disposition, name string) interface{} {
+	var (
+		err       error
+		file      *os.File
+		info      os.FileInfo
+		mediaType string
+	)
+
+	if c.Written() {
+		return ErrAlreadyWritten
+	}
+
+	if file, info, mediaType, err = openFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return c.NotFound()
+		}
+		return c.InternalServerError(DescError(err))
+	}
+	defer file.Close()
+
+	serveContent(c.Writer, c.Request, file, info, mediaType, disposition, name)
+	return "send file: " + path
+}
+
+// openFile opens a regular file of path and detects its media type,
+// a directory is reported as not exist
+func openFile(path string) (*os.File, os.FileInfo, string, error) {
+	var (
+		err       error
+		n         int
+		file      *os.File
+		info      os.FileInfo
+		mediaType string
+		sniff     [512]byte
+	)
+
+	if file, err = os.Open(path); err != nil {
+		return nil, nil, "", err
+	}
+
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return nil, nil, "", err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, "", &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	if mediaType = mime.TypeByExtension(filepath.Ext(path)); mediaType != "" {
+		return file, info, mediaType, nil
+	}
+
+	if n, err = io.ReadFull(file, sniff[:]); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		file.Close()
+		return nil, nil, "", err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, "", err
+	}
+
+	return file, info, http.DetectContentType(sniff[:n]), nil
+}
+
+// serveContent sends file through http.ServeContent, the ETag
+// is derived from modification time and size of the file
+func serveContent(w http.ResponseWriter, r *http.Request, file *os.File, info os.FileInfo, mediaType, disposition, name string) {
+	w.Header().Set(contentType, mediaType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
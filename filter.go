@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"gorm.io/gorm"
+)
+
+type (
+	// Filter is a filter of the query string, filter[field][operator]=value.
+	// Operator is FilterEq when it is omitted.
+	Filter struct {
+		Field    string `json:"field"`
+		Operator string `json:"operator"`
+		Value    string `json:"value"`
+	}
+
+	// FilterColumn whitelists a filter field, see FilteredColumn Filters
+	FilterColumn struct {
+		// Column is the column of the field, default is the field name
+		Column string
+		// Type converts values before they are bound
+		Type FilterType
+		// Operators allowed on the field, empty uses the defaults of Type
+		Operators []string
+	}
+
+	// FilterType is the value type of a filter field
+	FilterType int
+
+	// filterClause is a condition of a filter with bound arguments
+	filterClause struct {
+		query string
+		args  []interface{}
+	}
+)
+
+// filter value types
+const (
+	// FilterString compares values as strings
+	FilterString FilterType = iota
+
+	// FilterNumber compares values as integer or float numbers
+	FilterNumber
+
+	// FilterBool compares values as booleans
+	FilterBool
+
+	// FilterTime compares values as dates (2006-01-02) or RFC3339 times,
+	// dates are midnight in the time zone of tz
+	FilterTime
+)
+
+// filter operators
+const (
+	FilterEq   = "eq"
+	FilterNe   = "ne"
+	FilterGt   = "gt"
+	FilterGte  = "gte"
+	FilterLt   = "lt"
+	FilterLte  = "lte"
+	FilterIn   = "in"
+	FilterLike = "like"
+	// FilterNull matches NULL columns with true, the others with false
+	FilterNull = "null"
+)
+
+// filterKey matches filter[field] and filter[field][operator]
+var filterKey = regexp.MustCompile(`^filter\[([A-Za-z0-9_.]+)\](?:\[([a-z]+)\])?$`)
+
+// filterOperators maps operators to their sql comparison
+var filterOperators = map[string]string{
+	FilterEq:  "=",
+	FilterNe:  "<>",
+	FilterGt:  ">",
+	FilterGte: ">=",
+	FilterLt:  "<",
+	FilterLte: "<=",
+}
+
+// ValidateFilters checks the filters of urlQuery against columns.Filters.
+// Errors are returned as validation.Errors keyed by the query parameter,
+// e.g. filter[amount][gte], so they can be sent as 400-bad request.
+// Pagination and CursorPagination fail with the same error.
+func ValidateFilters(urlQuery URLQuery, columns *FilteredColumn) error {
+	if _, err := filterClauses(urlQuery, columns); err != nil {
+		return DescError(err)
+	}
+	return nil
+}
+
+// parseFilters returns the filters of query sorted by key.
+// Malformed filter keys are returned as validation.Errors.
+func parseFilters(query url.Values) ([]Filter, error) {
+	var (
+		key     string
+		value   string
+		keys    []string
+		match   []string
+		filters []Filter
+		errs    validation.Errors = validation.Errors{}
+	)
+
+	for key = range query {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key = range keys {
+		if match = filterKey.FindStringSubmatch(key); match == nil {
+			errs[key] = errors.New(invalidFilter)
+			continue
+		}
+		if match[2] == "" {
+			match[2] = FilterEq
+		}
+		for _, value = range query[key] {
+			filters = append(filters, Filter{Field: match[1], Operator: match[2], Value: value})
+		}
+	}
+
+	return filters, errs.Filter()
+}
+
+// filterClauses converts the filters of urlQuery into conditions,
+// only fields and operators whitelisted by columns are allowed
+func filterClauses(urlQuery URLQuery, columns *FilteredColumn) ([]filterClause, error) {
+	var (
+		err     error
+		ok      bool
+		key     string
+		loc     *time.Location
+		filter  Filter
+		spec    FilterColumn
+		clause  filterClause
+		clauses []filterClause
+		errs    validation.Errors = validation.Errors{}
+	)
+
+	if loc, err = location(urlQuery); err != nil {
+		return nil, validation.Errors{"tz": errors.New(invalidTimeZone)}
+	}
+
+	for _, filter = range urlQuery.Filters {
+		if filter.Operator == "" {
+			filter.Operator = FilterEq
+		}
+		key = "filter[" + filter.Field + "][" + filter.Operator + "]"
+
+		if columns != nil {
+			spec, ok = columns.Filters[filter.Field]
+		}
+		if columns == nil || !ok {
+			errs[key] = errors.New(filterNotAllowed)
+			continue
+		}
+		if !spec.allows(filter.Operator) {
+			errs[key] = fmt.Errorf(filterOperatorNotAllowed, filter.Operator)
+			continue
+		}
+		if spec.Column == "" {
+			spec.Column = filter.Field
+		}
+
+		if clause, err = spec.clause(filter, loc); err != nil {
+			errs[key] = err
+			continue
+		}
+		clauses = append(clauses, clause)
+	}
+
+	return clauses, errs.Filter()
+}
+
+// applyFilters adds the filters of urlQuery to db, invalid
+// filters are added to the errors of db
+func applyFilters(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
+	var (
+		err     error
+		clause  filterClause
+		clauses []filterClause
+	)
+
+	if clauses, err = filterClauses(urlQuery, columns); err != nil {
+		db.AddError(DescError(err))
+		return db
+	}
+
+	for _, clause = range clauses {
+		db = db.Where(clause.query, clause.args...)
+	}
+	return db
+}
+
+// allows returns true if operator is known and allowed on the column
+func (f FilterColumn) allows(operator string) bool {
+	var operators []string = f.Operators
+
+	if _, ok := filterOperators[operator]; !ok && operator != FilterIn &&
+		operator != FilterLike && operator != FilterNull {
+		return false
+	}
+
+	if len(operators) == 0 {
+		switch f.Type {
+		case FilterNumber, FilterTime:
+			operators = []string{FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte, FilterIn}
+		case FilterBool:
+			operators = []string{FilterEq, FilterNe}
+		default:
+			operators = []string{FilterEq, FilterNe, FilterIn}
+		}
+	}
+
+	for _, allowed := range operators {
+		if allowed == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// clause returns the condition of filter on the column,
+// times without zone are parsed in loc
+func (f FilterColumn) clause(filter Filter, loc *time.Location) (filterClause, error) {
+	var (
+		err    error
+		value  interface{}
+		values []interface{}
+		null   bool
+	)
+
+	switch filter.Operator {
+	case FilterNull:
+		if null, err = strconv.ParseBool(filter.Value); err != nil {
+			return filterClause{}, errors.New(invalidFilterBool)
+		}
+		if null {
+			return filterClause{query: f.Column + " IS NULL"}, nil
+		}
+		return filterClause{query: f.Column + " IS NOT NULL"}, nil
+
+	case FilterLike:
+		return filterClause{
+			query: f.Column + " LIKE ? ESCAPE '" + likeEscape + "'",
+			args:  []interface{}{"%" + escapeLike(filter.Value) + "%"},
+		}, nil
+
+	case FilterIn:
+		if strings.Count(filter.Value, ",") >= maxFilterValues {
+			return filterClause{}, fmt.Errorf(tooManyFilterValues, maxFilterValues)
+		}
+		for _, item := range strings.Split(filter.Value, ",") {
+			if value, err = f.value(item, loc); err != nil {
+				return filterClause{}, err
+			}
+			values = append(values, value)
+		}
+		return filterClause{query: f.Column + " IN ?", args: []interface{}{values}}, nil
+	}
+
+	if value, err = f.value(filter.Value, loc); err != nil {
+		return filterClause{}, err
+	}
+	return filterClause{query: f.Column + " " + filterOperators[filter.Operator] + " ?", args: []interface{}{value}}, nil
+}
+
+// value converts raw to Type of the column, a date
+// is midnight in loc
+func (f FilterColumn) value(raw string, loc *time.Location) (interface{}, error) {
+	switch f.Type {
+	case FilterNumber:
+		if number, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return number, nil
+		}
+		if number, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+			return number, nil
+		}
+		return nil, errors.New(invalidFilterNumber)
+	case FilterBool:
+		if value, err := strconv.ParseBool(raw); err == nil {
+			return value, nil
+		}
+		return nil, errors.New(invalidFilterBool)
+	case FilterTime:
+		if value, err := time.ParseInLocation(formatDate, raw, loc); err == nil {
+			return value.UTC(), nil
+		}
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value.UTC(), nil
+		}
+		return nil, errors.New(invalidFilterTime)
+	}
+	return raw, nil
+}
@@ -3,8 +3,6 @@ package handler
 import (
 	"fmt"
 	"log"
-	"os"
-	"strings"
 
 	"github.com/jinzhu/gorm"
 
@@ -62,10 +60,7 @@ func AddGormDBv1(alias string, prop *gormv1Config) {
 			log.Fatalf("[go-handler] fatal: %v", err.Error())
 		}
 
-		var debug string = os.Getenv("DEBUG_MODE")
-		debug = strings.ToLower(debug)
-
-		if debug == "true" || debug == "1" {
+		if isDebugMode() {
 			gormV1DBs[alias] = gormV1DBs[alias].Debug()
 		}
 	}
@@ -75,3 +70,22 @@ func AddGormDBv1(alias string, prop *gormv1Config) {
 func GetGormDBv1(alias string) *gorm.DB {
 	return gormV1DBs[alias].Set("gorm:auto_preload", true)
 }
+
+// closeGormDBsv1 closes and removes every gorm v1 connection
+func closeGormDBsv1() error {
+	var (
+		err      error
+		firstErr error
+		db       *gorm.DB
+	)
+
+	for _, db = range gormV1DBs {
+		if err = db.Close(); err != nil && firstErr == nil {
+			firstErr = DescError(err)
+		}
+	}
+
+	gormV1DBs = make(map[string]*gorm.DB)
+
+	return firstErr
+}
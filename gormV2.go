@@ -3,12 +3,11 @@ package handler
 import (
 	"fmt"
 	"math"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/jinzhu/copier"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -34,10 +33,7 @@ func getGormConfig(config *GormConfig) *gorm.Config {
 }
 
 func gormDebug(db *gorm.DB) *gorm.DB {
-	var debug string
-	debug = strings.ToLower(os.Getenv("DEBUG_MODE"))
-
-	if debug == "true" || debug == "1" {
+	if isDebugMode() {
 		return db.Debug()
 	}
 
@@ -113,41 +109,29 @@ func ConnectMssql(alias string, config *GormConfig) error {
 // Pagination set offset and limit of query.
 // Default value of limit is 10, and offset of page 1.
 // Note: dateColumn is an optional parameter and the function
-// only use dateColumn[0]. Call this function before PageResult
+// only use dateColumn[0]. Call this function before PageResult.
+// Filters and sort are validated against columns first, an invalid one
+// fails the query with *Error listing them in Fields, see FieldErrors.
 func Pagination(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
 	var (
-		id      int
-		keyword string
-		column  string
-		limit   int    = 10
-		page    int    = 0
-		between string = "%s = ?"
+		err   error
+		limit int = 10
+		page  int = 0
 	)
 
 	if len(urlQuery.ItemsPerPage) != 0 {
 		limit, _ = strconv.Atoi(urlQuery.ItemsPerPage)
 	}
 
-	if columns != nil && len(columns.OrderBy) > 0 {
-		if strings.ToLower(urlQuery.Descending) == logicalTrue {
-			db = db.Order(columns.OrderBy + " DESC")
-		} else {
-			db = db.Order(columns.OrderBy + " ASC")
-		}
-	}
+	// a new instance, the statement of db is never shared
+	db = db.Limit(limit)
 
-	if columns != nil && len(columns.KeywordColumns) > 0 && len(urlQuery.Keyword) > 0 {
-		keyword = fmt.Sprintf("%s like '%%%s%%'", columns.KeywordColumns[0], urlQuery.Keyword)
-		for id, column = range columns.KeywordColumns {
-			if id == 0 {
-				continue
-			}
-			keyword = keyword + fmt.Sprintf(" or %s like '%%%s%%'", column, urlQuery.Keyword)
-		}
-		db = db.Where(keyword)
+	if err = validateQuery(urlQuery, columns); err != nil {
+		db.AddError(err)
+		return db
 	}
 
-	db = db.Limit(limit)
+	db = applySort(db, urlQuery, columns)
 
 	if len(urlQuery.Page) != 0 {
 		page, _ = strconv.Atoi(urlQuery.Page)
@@ -155,25 +139,106 @@ func Pagination(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.D
 	}
 	db = db.Offset(page)
 
+	return filterQuery(db, urlQuery, columns)
+}
+
+// validateQuery checks the filters and the sort of urlQuery against
+// columns, errors of both are returned together as validation.Errors
+func validateQuery(urlQuery URLQuery, columns *FilteredColumn) error {
+	var (
+		err  error
+		key  string
+		errs validation.Errors = validation.Errors{}
+	)
+
+	if _, err = filterClauses(urlQuery, columns); err != nil {
+		for key, err = range err.(validation.Errors) {
+			errs[key] = err
+		}
+	}
+	if _, err = sortKeys(urlQuery, columns); err != nil {
+		for key, err = range err.(validation.Errors) {
+			errs[key] = err
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return DescError(errs)
+}
+
+// filterQuery applies keyword, field and date filters of urlQuery
+func filterQuery(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
+	var (
+		keyword string
+		args    []interface{}
+	)
+
+	if len(urlQuery.Filters) > 0 {
+		db = applyFilters(db, urlQuery, columns)
+	}
+
+	if columns != nil && len(columns.KeywordColumns) > 0 && len(urlQuery.Keyword) > 0 {
+		keyword, args = keywordCondition(db, columns, urlQuery.Keyword)
+		db = db.Where(keyword, args...)
+	}
+
 	if columns != nil && columns.DateColumn != "" {
+		db = applyDateFilter(db, urlQuery, columns)
+	}
+
+	return db
+}
+
+// keywordCondition returns the keyword search of columns as a single
+// condition with bound arguments. LIKE wildcards of keyword are escaped.
+func keywordCondition(db *gorm.DB, columns *FilteredColumn, keyword string) (string, []interface{}) {
+	var (
+		column     string
+		match      KeywordMatch
+		pattern    string
+		conditions []string
+		args       []interface{}
+		escape     string = " ESCAPE '" + likeEscape + "'"
+		postgres   bool   = db.Dialector.Name() == "postgres"
+	)
+
+	for _, column = range columns.KeywordColumns {
+		match = columns.KeywordMatch[column]
+
+		switch match &^ MatchInsensitive {
+		case MatchExact:
+			pattern = escapeLike(keyword)
+		case MatchPrefix:
+			pattern = escapeLike(keyword) + "%"
+		default:
+			pattern = "%" + escapeLike(keyword) + "%"
+		}
+
 		switch {
-		// if start and end sets
-		case len(urlQuery.StartDate) > 0 && len(urlQuery.EndDate) > 0:
-			between = fmt.Sprintf("%s between ? and ?", columns.DateColumn)
-			return db.Where(between, urlQuery.StartDate, urlQuery.EndDate)
-		case len(urlQuery.StartDate) > 0:
-			between = fmt.Sprintf(between, columns.DateColumn)
-			return db.Where(between, urlQuery.StartDate)
-		case len(urlQuery.EndDate) > 0:
-			between = fmt.Sprintf("%s between ? and ?", columns.DateColumn)
-			return db.Where(between, time.Now().Format(formatDate), urlQuery.EndDate)
+		case match&MatchInsensitive == 0:
+			conditions = append(conditions, column+" LIKE ?"+escape)
+		case postgres:
+			conditions = append(conditions, column+" ILIKE ?"+escape)
 		default:
-			between = fmt.Sprintf(between, columns.DateColumn)
-			return db.Where(between, time.Now().Format(formatDate))
+			conditions = append(conditions, "LOWER("+column+") LIKE LOWER(?)"+escape)
 		}
+		args = append(args, pattern)
 	}
 
-	return db
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// escapeLike escapes LIKE wildcards of value with likeEscape,
+// "[" is escaped for sql server
+func escapeLike(value string) string {
+	return strings.NewReplacer(
+		likeEscape, likeEscape+likeEscape,
+		"%", likeEscape+"%",
+		"_", likeEscape+"_",
+		"[", likeEscape+"[",
+	).Replace(value)
 }
 
 // PageResult handle detail of BuildQuery and returns PaginationResult.
@@ -181,12 +246,10 @@ func Pagination(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.D
 // Warning: must supply executed gorm.DB object () ex: PageResult(db.Find(&users), urlQuery)
 func PageResult(dbResult *gorm.DB, resultSet interface{}, urlQuery URLQuery) PaginationResult {
 	var (
-		count     int64
-		limit     int = 10
-		page      int = 0
-		result    PaginationResult
-		startDate time.Time
-		endDate   time.Time
+		count  int64
+		limit  int = 10
+		page   int = 0
+		result PaginationResult
 	)
 
 	if reflect.TypeOf(resultSet).Kind() != reflect.Slice {
@@ -216,15 +279,34 @@ func PageResult(dbResult *gorm.DB, resultSet interface{}, urlQuery URLQuery) Pag
 	result.TotalItems = count
 	result.TotalPage = int64(math.Ceil(float64(count) / float64(limit)))
 
-	if urlQuery.StartDate != "" {
-		startDate, _ = time.Parse(formatDate, urlQuery.StartDate)
-		result.StartDate = &startDate
-	}
+	result.StartDate, result.EndDate, result.DateRange = resultDates(dbResult)
+
+	return result
+}
+
+// closeGormDBs closes and removes every gorm v2 connection
+func closeGormDBs() error {
+	var (
+		err      error
+		firstErr error
+		db       *gorm.DB
+	)
 
-	if urlQuery.EndDate != "" {
-		endDate, _ = time.Parse(formatDate, urlQuery.EndDate)
-		result.EndDate = &endDate
+	for _, db = range gormDBs {
+		if err = closeGormDB(db); err != nil && firstErr == nil {
+			firstErr = DescError(err)
+		}
 	}
 
-	return result
+	gormDBs = make(map[string]*gorm.DB)
+
+	return firstErr
+}
+
+func closeGormDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
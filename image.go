@@ -0,0 +1,469 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-redis/redis"
+	"golang.org/x/image/draw"
+
+	// register webp decoder, webp sources are converted
+	_ "golang.org/x/image/webp"
+)
+
+type (
+	// ImageOptions configure Context.SendImageWith, limits and
+	// quality of zero or less use the defaults of NewImageOptions
+	ImageOptions struct {
+		// MaxWidth and MaxHeight limit the requested size
+		MaxWidth  int
+		MaxHeight int
+		// MaxPixels limits width * height of the source image,
+		// larger images are rejected before being decoded
+		MaxPixels int
+		// Quality of JPEG output when q is not requested
+		Quality int
+		// Cache stores transformed images, nil disables caching
+		Cache ImageCache
+	}
+
+	// ImageTransform is the transformation requested by query
+	// parameters w, h, fit, q and fmt
+	ImageTransform struct {
+		Width   int
+		Height  int
+		Fit     string
+		Quality int
+		Format  string
+	}
+
+	// ImageCache stores transformed images by key
+	ImageCache interface {
+		// Get returns the image of key, ok is false on a miss
+		Get(key string) (data []byte, ok bool, err error)
+		Set(key string, data []byte) error
+	}
+
+	// DiskImageCache stores transformed images as files in Dir
+	DiskImageCache struct {
+		Dir string
+	}
+
+	// RedisImageCache stores transformed images in redis,
+	// zero TTL keeps them forever
+	RedisImageCache struct {
+		Client *redis.Client
+		Prefix string
+		TTL    time.Duration
+	}
+)
+
+const (
+	// FitCover scales the image to cover the requested size and crops the rest
+	FitCover = "cover"
+
+	// FitContain scales the image to fit within the requested size
+	FitContain = "contain"
+
+	// FitFill stretches the image to the requested size
+	FitFill = "fill"
+)
+
+// NewImageOptions returns default ImageOptions, the size is limited to
+// 4096x4096, sources to 25 megapixels and JPEG quality is 85
+func NewImageOptions() *ImageOptions {
+	return &ImageOptions{
+		MaxWidth:  defaultImageMaxSize,
+		MaxHeight: defaultImageMaxSize,
+		MaxPixels: defaultImageMaxPixels,
+		Quality:   defaultImageQuality,
+	}
+}
+
+// NewDiskImageCache returns DiskImageCache of dir, dir is created if needed
+func NewDiskImageCache(dir string) (*DiskImageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, DescError(err)
+	}
+	return &DiskImageCache{Dir: dir}, nil
+}
+
+// Get implements ImageCache Get
+func (c *DiskImageCache) Get(key string) ([]byte, bool, error) {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = os.ReadFile(filepath.Join(c.Dir, key)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set implements ImageCache Set, the file is written atomically
+func (c *DiskImageCache) Set(key string, data []byte) error {
+	var (
+		err  error
+		file *os.File
+	)
+
+	if file, err = os.CreateTemp(c.Dir, key+".*.tmp"); err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(c.Dir, key))
+}
+
+// Get implements ImageCache Get
+func (c *RedisImageCache) Get(key string) ([]byte, bool, error) {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = c.Client.Get(c.Prefix + key).Bytes(); err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set implements ImageCache Set
+func (c *RedisImageCache) Set(key string, data []byte) error {
+	return c.Client.Set(c.Prefix+key, data, c.TTL).Err()
+}
+
+// SendImage sends image of path transformed by the query parameters
+// with default ImageOptions. See SendImageWith.
+func (c *Context) SendImage(path string) interface{} {
+	return c.SendImageWith(path, nil)
+}
+
+// SendImageWith sends image of path transformed by the query parameters,
+// without them the file is sent as is. If the file does not exist or is
+// not an image, the image of ERROR_IMAGE env is sent instead.
+//
+//	w, h   size in pixels, one of them keeps the aspect ratio
+//	fit    cover, contain (default) or fill
+//	q      JPEG quality 1-100
+//	fmt    output format jpeg, png or gif
+//
+// Invalid parameters are answered with 400-bad request.
+func (c *Context) SendImageWith(path string, opt *ImageOptions) interface{} {
+	var (
+		err       error
+		ok        bool
+		key       string
+		data      []byte
+		file      *os.File
+		info      os.FileInfo
+		mediaType string
+		transform ImageTransform
+	)
+
+	if opt == nil {
+		opt = NewImageOptions()
+	}
+
+	if transform, err = ParseImageTransform(c.Request.URL.Query(), opt); err != nil {
+		return c.BadRequest(err)
+	}
+	if transform.empty() {
+		return c.sendImage(path)
+	}
+	transform = transform.withDefaults(opt)
+
+	if c.Written() {
+		return ErrAlreadyWritten
+	}
+
+	if file, info, mediaType, err = openFile(path); err == nil && !strings.HasPrefix(mediaType, "image/") {
+		file.Close()
+		err = &Error{Description: decodeFail}
+	}
+	if err != nil {
+		Logger(DescError(err))
+		return errorImage(c.Writer, c.Request)
+	}
+	defer file.Close()
+
+	key = transform.key(path, info)
+
+	if opt.Cache != nil {
+		if data, ok, err = opt.Cache.Get(key); err != nil {
+			Logger(DescError(err))
+		}
+	}
+
+	if !ok {
+		if data, err = transformImage(file, transform, opt); err != nil {
+			// the requested size is too large for the source
+			if FieldErrors(err) != nil {
+				return c.BadRequest(err)
+			}
+			return c.UnprocessableEntity(err)
+		}
+
+		if opt.Cache != nil {
+			if err = opt.Cache.Set(key, data); err != nil {
+				Logger(DescError(err))
+			}
+		}
+	}
+
+	// the format of a cached image is unknown when fmt is not requested
+	c.Writer.Header().Set(contentType, http.DetectContentType(data))
+	c.Writer.Header().Set("Content-Disposition", "inline")
+	c.Writer.Header().Set("ETag", `"`+key+`"`)
+	setImageHeaders(c.Writer)
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), bytes.NewReader(data))
+
+	return "send image: " + path
+}
+
+// ParseImageTransform parses w, h, fit, q and fmt of query within
+// the limits of opt, parameters which are not requested are left
+// empty. Errors are returned as validation.Errors.
+func ParseImageTransform(query map[string][]string, opt *ImageOptions) (ImageTransform, error) {
+	var (
+		err       error
+		errs      validation.Errors = validation.Errors{}
+		transform ImageTransform
+		values    imageQuery = query
+	)
+
+	transform.Width, errs["w"] = values.int("w", validation.Min(1),
+		validation.Max(orDefault(opt.MaxWidth, defaultImageMaxSize)))
+	transform.Height, errs["h"] = values.int("h", validation.Min(1),
+		validation.Max(orDefault(opt.MaxHeight, defaultImageMaxSize)))
+	transform.Quality, errs["q"] = values.int("q", validation.Min(1), validation.Max(100))
+
+	transform.Fit = strings.ToLower(values.get("fit"))
+	errs["fit"] = validation.Validate(transform.Fit, validation.In(FitCover, FitContain, FitFill))
+
+	transform.Format = strings.ToLower(values.get("fmt"))
+	if transform.Format == "jpg" {
+		transform.Format = "jpeg"
+	}
+	errs["fmt"] = validation.Validate(transform.Format, validation.In("jpeg", "png", "gif"))
+
+	if err = errs.Filter(); err != nil {
+		return transform, err
+	}
+
+	return transform, nil
+}
+
+// imageQuery are query values of an image request
+type imageQuery map[string][]string
+
+// get returns the first value of key
+func (u imageQuery) get(key string) string {
+	if len(u[key]) == 0 {
+		return ""
+	}
+	return u[key][0]
+}
+
+// int parses value of key, zero if missing
+func (u imageQuery) int(key string, rules ...validation.Rule) (int, error) {
+	var (
+		err   error
+		value int
+	)
+
+	if u.get(key) == "" {
+		return 0, nil
+	}
+	if value, err = strconv.Atoi(u.get(key)); err != nil {
+		return 0, errors.New("must be an integer number")
+	}
+	return value, validation.Validate(value, rules...)
+}
+
+// empty returns true if no transformation is requested
+func (t ImageTransform) empty() bool {
+	return t.Width == 0 && t.Height == 0 && t.Fit == "" && t.Quality == 0 && t.Format == ""
+}
+
+// withDefaults returns t with the fit and quality
+// which are not requested taken from defaults
+func (t ImageTransform) withDefaults(opt *ImageOptions) ImageTransform {
+	if t.Fit == "" {
+		t.Fit = FitContain
+	}
+	if t.Quality == 0 {
+		t.Quality = orDefault(opt.Quality, defaultImageQuality)
+	}
+	return t
+}
+
+// orDefault returns value, or fallback if value is zero or less
+func orDefault(value int, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// key returns cache key of the transformation of the file
+func (t ImageTransform) key(path string, info os.FileInfo) string {
+	var sum [32]byte = sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d|%d|%s|%d|%s",
+		path, info.ModTime().UnixNano(), info.Size(), t.Width, t.Height, t.Fit, t.Quality, t.Format)))
+	return hex.EncodeToString(sum[:])
+}
+
+// transformImage decodes, resizes and encodes the image of r. The
+// dimensions of the source and of the result are checked before
+// decoding to reject decompression bombs.
+func transformImage(r io.ReadSeeker, transform ImageTransform, opt *ImageOptions) ([]byte, error) {
+	var (
+		err    error
+		config image.Config
+		format string
+		src    image.Image
+		dst    *image.RGBA
+		crop   image.Rectangle
+		size   image.Rectangle
+		buffer bytes.Buffer
+	)
+
+	if config, format, err = image.DecodeConfig(r); err != nil {
+		return nil, DescError(err)
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width*config.Height > orDefault(opt.MaxPixels, defaultImageMaxPixels) {
+		return nil, &Error{Description: fmt.Sprintf(imageTooLarge, config.Width, config.Height)}
+	}
+
+	crop, size = resizeTarget(image.Rect(0, 0, config.Width, config.Height), transform)
+	if err = checkTarget(size, transform, opt); err != nil {
+		return nil, err
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, DescError(err)
+	}
+	if src, _, err = image.Decode(r); err != nil {
+		return nil, DescError(err)
+	}
+
+	if transform.Format == "" {
+		transform.Format = format
+		if format != "jpeg" && format != "png" && format != "gif" {
+			transform.Format = "png"
+		}
+	}
+
+	// decoders may place the image at a non-zero origin
+	dst = image.NewRGBA(size)
+	crop = crop.Add(src.Bounds().Min)
+
+	// JPEG has no alpha channel, flatten on white
+	if transform.Format == "jpeg" {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	switch transform.Format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, dst, &jpeg.Options{Quality: transform.Quality})
+	case "png":
+		err = png.Encode(&buffer, dst)
+	case "gif":
+		err = gif.Encode(&buffer, dst, nil)
+	}
+	if err != nil {
+		return nil, DescError(err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// checkTarget rejects a result larger than the limits of opt, a side
+// derived from the aspect ratio may be far larger than the requested one
+func checkTarget(size image.Rectangle, transform ImageTransform, opt *ImageOptions) error {
+	var key string = "w"
+
+	if size.Dx() <= orDefault(opt.MaxWidth, defaultImageMaxSize) &&
+		size.Dy() <= orDefault(opt.MaxHeight, defaultImageMaxSize) &&
+		size.Dx()*size.Dy() <= orDefault(opt.MaxPixels, defaultImageMaxPixels) {
+		return nil
+	}
+
+	if transform.Width == 0 {
+		key = "h"
+	}
+	return DescError(validation.Errors{key: fmt.Errorf(resultTooLarge, size.Dx(), size.Dy())})
+}
+
+// resizeTarget returns the source rectangle to draw and
+// the destination rectangle of transform
+func resizeTarget(bounds image.Rectangle, transform ImageTransform) (image.Rectangle, image.Rectangle) {
+	var (
+		width  int     = transform.Width
+		height int     = transform.Height
+		sw     float64 = float64(bounds.Dx())
+		sh     float64 = float64(bounds.Dy())
+		scale  float64
+		cw, ch int
+	)
+
+	switch {
+	case width == 0 && height == 0:
+		width, height = bounds.Dx(), bounds.Dy()
+	case width == 0:
+		width = atLeastOne(sw * float64(height) / sh)
+	case height == 0:
+		height = atLeastOne(sh * float64(width) / sw)
+	case transform.Fit == FitContain:
+		scale = math.Min(float64(width)/sw, float64(height)/sh)
+		width, height = atLeastOne(sw*scale), atLeastOne(sh*scale)
+	case transform.Fit == FitCover:
+		scale = math.Max(float64(width)/sw, float64(height)/sh)
+		cw, ch = atLeastOne(float64(width)/scale), atLeastOne(float64(height)/scale)
+		bounds = image.Rect(0, 0, cw, ch).Add(bounds.Min).
+			Add(image.Pt((bounds.Dx()-cw)/2, (bounds.Dy()-ch)/2)).Intersect(bounds)
+	}
+
+	return bounds, image.Rect(0, 0, width, height)
+}
+
+// atLeastOne rounds value to a pixel count of at least one
+func atLeastOne(value float64) int {
+	if value < 1 {
+		return 1
+	}
+	return int(value + 0.5)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePNG writes a blank width x height png into dir
+func writePNG(t *testing.T, dir string, name string, width, height int) string {
+	var path string = filepath.Join(dir, name)
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err = png.Encode(file, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSendImageDerivedSideLimit(t *testing.T) {
+	var (
+		dir string        = t.TempDir()
+		ctx *Context      = New()
+		opt *ImageOptions = &ImageOptions{MaxWidth: 64, MaxHeight: 64, MaxPixels: 4096}
+	)
+
+	// both sources are within MaxPixels, the side derived from them is not
+	tall := writePNG(t, dir, "tall.png", 2, 1000)
+	wide := writePNG(t, dir, "wide.png", 1000, 2)
+	small := writePNG(t, dir, "small.png", 20, 40)
+
+	ctx.GET("/tall", func(c *Context) interface{} { return c.SendImageWith(tall, opt) })
+	ctx.GET("/wide", func(c *Context) interface{} { return c.SendImageWith(wide, opt) })
+	ctx.GET("/small", func(c *Context) interface{} { return c.SendImageWith(small, opt) })
+
+	tests := []struct {
+		path   string
+		status int
+		width  int
+		height int
+	}{
+		{"/tall?w=64", http.StatusBadRequest, 0, 0},
+		{"/wide?h=64", http.StatusBadRequest, 0, 0},
+		{"/tall?h=64", http.StatusOK, 1, 64},
+		{"/wide?w=64", http.StatusOK, 64, 1},
+		{"/small?w=16", http.StatusOK, 16, 32},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		ctx.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.path, w.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		config, _, err := image.DecodeConfig(w.Body)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if config.Width != test.width || config.Height != test.height {
+			t.Errorf("%s: size %dx%d, want %dx%d", test.path, config.Width, config.Height, test.width, test.height)
+		}
+	}
+}
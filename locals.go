@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type (
+	// localsKey is the request context key of locals
+	localsKey struct{}
+
+	// locals holds request-local values
+	locals struct {
+		mu     sync.RWMutex
+		values map[string]interface{}
+	}
+)
+
+// getLocals returns request-local storage of r or nil
+func getLocals(r *http.Request) *locals {
+	var store, _ = r.Context().Value(localsKey{}).(*locals)
+	return store
+}
+
+// SetLocal stores value under key in the request-local storage of r.
+// The storage is created on first use so middlewares must pass
+// the returned request to the next handler, e.g.
+//
+//	next.ServeHTTP(w, handler.SetLocal(r, "user", user))
+func SetLocal(r *http.Request, key string, value interface{}) *http.Request {
+	var store *locals
+
+	if store = getLocals(r); store == nil {
+		store = &locals{values: make(map[string]interface{})}
+		r = r.WithContext(context.WithValue(r.Context(), localsKey{}, store))
+	}
+
+	store.mu.Lock()
+	store.values[key] = value
+	store.mu.Unlock()
+
+	return r
+}
+
+// LookupLocal returns value stored under key in the
+// request-local storage of r and whether it exists
+func LookupLocal(r *http.Request, key string) (interface{}, bool) {
+	var (
+		ok    bool
+		value interface{}
+		store *locals
+	)
+
+	if store = getLocals(r); store == nil {
+		return nil, false
+	}
+
+	store.mu.RLock()
+	value, ok = store.values[key]
+	store.mu.RUnlock()
+
+	return value, ok
+}
+
+// Set stores value under key in the request-local storage
+func (c *Context) Set(key string, value interface{}) {
+	c.setRequest(SetLocal(c.Request, key, value))
+}
+
+// Local returns value stored under key in the request-local storage
+// and whether it exists. It is not named Get because Get is the GET
+// handler of RestHandlers, use handler.Local for a typed value.
+func (c *Context) Local(key string) (interface{}, bool) {
+	return LookupLocal(c.Request, key)
+}
+
+// Local returns value stored under key as T. ok is false if
+// key does not exist or its value is not a T, e.g.
+//
+//	user, ok := handler.Local[*User](ctx, "user")
+func Local[T any](c *Context, key string) (value T, ok bool) {
+	var raw interface{}
+
+	if raw, ok = c.Local(key); !ok {
+		return value, false
+	}
+
+	value, ok = raw.(T)
+	return value, ok
+}
@@ -5,7 +5,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"runtime/debug"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 // AddHSTS sets HSTS header
@@ -53,3 +56,50 @@ func Logging(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Recover catches panics of the next handlers, logs the stack trace
+// and sends a 500-internal server error. New installs it by default.
+func Recover(next http.Handler) http.Handler {
+	return RecoverWith(RecoverOptions{})(next)
+}
+
+// RecoverWith returns Recover middleware configured by opt
+func RecoverWith(opt RecoverOptions) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+			// share the response state with the next handlers
+			var w ResponseWriter = WrapWriter(writer)
+
+			defer func() {
+				var (
+					rec interface{}
+					err error = &errInternalServerError
+				)
+
+				if rec = recover(); rec == nil {
+					return
+				}
+
+				// let net/http abort the response silently
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				Logger(&Error{
+					Description: fmt.Sprintf("panic: %v\n%s", rec, debug.Stack()),
+				})
+
+				if opt.ShowPanic && isDebugMode() {
+					err = &Error{Description: fmt.Sprintf("panic: %v", rec)}
+				}
+
+				if w.Header().Get(contentType) == "" {
+					w.Header().Set(contentType, "application/json")
+				}
+				errorRenderer(w, r, MessageInternalServerError, err, http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type (
+	// ErrorRenderer writes an error response of status. It is used by
+	// every error helper of Context, PageNotFound404 and MethodNotAllowed405
+	ErrorRenderer func(w http.ResponseWriter, r *http.Request, message string, err error, status int) interface{}
+
+	// ProblemDetails RFC 7807 problem details object.
+	// Extensions are marshalled as top level members
+	ProblemDetails struct {
+		Type       string                 `json:"type"`
+		Title      string                 `json:"title"`
+		Status     int                    `json:"status"`
+		Detail     string                 `json:"detail,omitempty"`
+		Instance   string                 `json:"instance,omitempty"`
+		Extensions map[string]interface{} `json:"-"`
+	}
+)
+
+var errorRenderer ErrorRenderer = RenderResponse
+
+// SetErrorRenderer switch the renderer of error responses,
+// e.g. SetErrorRenderer(handler.RenderProblem). nil restores
+// the default RenderResponse.
+func SetErrorRenderer(renderer ErrorRenderer) {
+	if renderer == nil {
+		renderer = RenderResponse
+	}
+	errorRenderer = renderer
+}
+
+// RenderResponse writes err as data of the default Response
+func RenderResponse(w http.ResponseWriter, r *http.Request, message string, err error, status int) interface{} {
+	return response(w, r, message, err, status)
+}
+
+// RenderProblem writes err as application/problem+json
+func RenderProblem(w http.ResponseWriter, r *http.Request, message string, err error, status int) interface{} {
+	var problem *ProblemDetails = NewProblem(r, message, err, status)
+
+	// never write a response twice
+	if isWritten(w) {
+		Logger(ErrAlreadyWritten)
+		return ErrAlreadyWritten
+	}
+
+	w.Header().Set(contentType, problemJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+
+	Logger(problem)
+
+	return problem
+}
+
+// NewProblem builds problem details from err. Title is message,
+// detail is the error description and failing fields of
+// validation errors are listed in "fields" extension member.
+func NewProblem(r *http.Request, message string, err error, status int) *ProblemDetails {
+	var (
+		custError *Error
+		problem   *ProblemDetails = &ProblemDetails{
+			Type:   problemTypeBlank,
+			Title:  message,
+			Status: status,
+		}
+	)
+
+	if r != nil {
+		problem.Instance = r.URL.RequestURI()
+	}
+
+	if err == nil {
+		return problem
+	}
+
+	custError = DescError(err)
+	if custError.Description != message {
+		problem.Detail = custError.Description
+	}
+	if len(custError.Fields) > 0 {
+		problem.Extensions = map[string]interface{}{
+			"fields": custError.Fields,
+		}
+	}
+
+	return problem
+}
+
+// MarshalJSON flatten Extensions into problem members.
+// Standard members always win over extensions.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	type problemDetails ProblemDetails
+	var (
+		err     error
+		raw     []byte
+		members map[string]interface{} = make(map[string]interface{})
+	)
+
+	if raw, err = json.Marshal(problemDetails(p)); err != nil {
+		return nil, err
+	}
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	if err = json.Unmarshal(raw, &members); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(members)
+}
+
+// Error implementation of error interface
+func (p *ProblemDetails) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
@@ -48,3 +48,22 @@ func GetRedis(alias string) (*redis.Client, error) {
 	}
 	return redisDBs[alias], nil
 }
+
+// closeRedis closes and removes every redis client
+func closeRedis() error {
+	var (
+		err      error
+		firstErr error
+		client   *redis.Client
+	)
+
+	for _, client = range redisDBs {
+		if err = client.Close(); err != nil && firstErr == nil {
+			firstErr = DescError(err)
+		}
+	}
+
+	redisDBs = make(map[string]*redis.Client)
+
+	return firstErr
+}
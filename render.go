@@ -0,0 +1,545 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type (
+	// Renderer encodes response payload into a media type
+	Renderer interface {
+		ContentType() string
+		Render(w io.Writer, payload interface{}) error
+	}
+
+	// DataRenderer is a Renderer which encodes data without
+	// the envelope, response calls RenderData instead of Render
+	DataRenderer interface {
+		Renderer
+		RenderData(w io.Writer, data interface{}) error
+	}
+
+	// JSONRenderer renders payload as application/json
+	JSONRenderer struct{}
+
+	// XMLRenderer renders payload as application/xml
+	XMLRenderer struct{}
+
+	// MsgpackRenderer renders payload as application/msgpack,
+	// fields are named by their json tag
+	MsgpackRenderer struct{}
+
+	// CSVRenderer renders data as text/csv without envelope. Data may
+	// be a struct, a map, a slice of them or [][]string. Column names
+	// are taken from json tags.
+	CSVRenderer struct{}
+
+	// acceptRange media range of Accept header
+	acceptRange struct {
+		mediaType string
+		quality   float64
+	}
+)
+
+var (
+	renderersMu sync.RWMutex
+	renderers   map[string]Renderer = map[string]Renderer{
+		"application/json":      JSONRenderer{},
+		"application/xml":       XMLRenderer{},
+		"text/xml":              XMLRenderer{},
+		"application/msgpack":   MsgpackRenderer{},
+		"application/x-msgpack": MsgpackRenderer{},
+		"text/csv":              CSVRenderer{},
+	}
+	timeType reflect.Type = reflect.TypeOf(time.Time{})
+)
+
+// RegisterRenderer registers renderer of mediaType, it replaces
+// the current renderer of mediaType if any
+func RegisterRenderer(mediaType string, renderer Renderer) {
+	renderersMu.Lock()
+	renderers[strings.ToLower(mediaType)] = renderer
+	renderersMu.Unlock()
+}
+
+// getRenderer returns renderer of mediaType or nil
+func getRenderer(mediaType string) Renderer {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	return renderers[mediaType]
+}
+
+// negotiate selects renderer of the response. The Content-Type already
+// set on w (e.g. by JSONify) is kept unless the Accept header of r names
+// a registered media type with a higher quality than it, "*/*" and
+// "type/*" ranges never override it. Without Content-Type the best
+// matching range is used. Returns nil if there is no suitable renderer.
+func negotiate(w http.ResponseWriter, r *http.Request) Renderer {
+	var (
+		err       error
+		quality   float64
+		current   Renderer
+		renderer  Renderer
+		accept    acceptRange
+		ranges    []acceptRange
+		mediaType string
+	)
+
+	if mediaType, _, err = mime.ParseMediaType(w.Header().Get(contentType)); err == nil {
+		current = getRenderer(mediaType)
+	}
+
+	if r == nil {
+		return current
+	}
+	ranges = parseAccept(r.Header.Get("Accept"))
+
+	if current == nil {
+		for _, accept = range ranges {
+			if renderer = matchRenderer(accept.mediaType); renderer != nil {
+				return renderer
+			}
+		}
+		return nil
+	}
+
+	// ranges are sorted by quality
+	quality = acceptQuality(ranges, mediaType)
+	for _, accept = range ranges {
+		if accept.quality <= quality {
+			break
+		}
+		if strings.HasSuffix(accept.mediaType, "/*") {
+			continue
+		}
+		if renderer = getRenderer(accept.mediaType); renderer != nil {
+			return renderer
+		}
+	}
+
+	return current
+}
+
+// acceptQuality returns quality of mediaType taken from the most
+// specific range of ranges which matches it, zero if none does
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	var (
+		quality     float64
+		specificity int = -1
+		level       int
+		accept      acceptRange
+		wildcard    string = mediaType[:strings.Index(mediaType, "/")+1] + "*"
+	)
+
+	for _, accept = range ranges {
+		switch accept.mediaType {
+		case mediaType:
+			level = 2
+		case wildcard:
+			level = 1
+		case "*/*":
+			level = 0
+		default:
+			continue
+		}
+
+		if level > specificity {
+			specificity, quality = level, accept.quality
+		}
+	}
+
+	return quality
+}
+
+// matchRenderer returns renderer of mediaType, "type/*" matches
+// the first registered subtype in alphabetical order. "*/*" never
+// matches so the response Content-Type decides.
+func matchRenderer(mediaType string) Renderer {
+	var (
+		prefix     string
+		registered string
+		candidates []string
+	)
+
+	if mediaType == "*/*" {
+		return nil
+	}
+
+	if !strings.HasSuffix(mediaType, "/*") {
+		return getRenderer(mediaType)
+	}
+
+	prefix = strings.TrimSuffix(mediaType, "*")
+
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	for registered = range renderers {
+		if strings.HasPrefix(registered, prefix) {
+			candidates = append(candidates, registered)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Strings(candidates)
+	return renderers[candidates[0]]
+}
+
+// parseAccept returns media ranges of accept sorted by quality,
+// ranges with zero quality are omitted
+func parseAccept(accept string) []acceptRange {
+	var (
+		err    error
+		part   string
+		ranges []acceptRange
+		params map[string]string
+		item   acceptRange
+	)
+
+	for _, part = range strings.Split(accept, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		item = acceptRange{quality: 1}
+		if item.mediaType, params, err = mime.ParseMediaType(part); err != nil {
+			continue
+		}
+
+		if q, ok := params["q"]; ok {
+			if item.quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		if item.quality > 0 {
+			ranges = append(ranges, item)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	return ranges
+}
+
+// ContentType implements Renderer ContentType
+func (JSONRenderer) ContentType() string {
+	return "application/json"
+}
+
+// Render implements Renderer Render
+func (JSONRenderer) Render(w io.Writer, payload interface{}) error {
+	return json.NewEncoder(w).Encode(payload)
+}
+
+// ContentType implements Renderer ContentType
+func (XMLRenderer) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+// Render implements Renderer Render. Payloads which encoding/xml
+// does not support, e.g. maps, are encoded from their json form.
+func (XMLRenderer) Render(w io.Writer, payload interface{}) error {
+	var (
+		err     error
+		ok      bool
+		buffer  bytes.Buffer
+		encoder *xml.Encoder
+		decoder *json.Decoder
+		data    []byte
+	)
+
+	buffer.WriteString(xml.Header)
+	if err = xml.NewEncoder(&buffer).Encode(payload); err == nil {
+		_, err = buffer.WriteTo(w)
+		return err
+	}
+
+	if _, ok = err.(*xml.UnsupportedTypeError); !ok {
+		return err
+	}
+
+	if data, err = json.Marshal(payload); err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder = xml.NewEncoder(w)
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = jsonToXML(encoder, decoder, xmlRoot); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// jsonToXML encodes the next json value of decoder as element name,
+// objects keep the order of their keys and array items are <item>
+func jsonToXML(encoder *xml.Encoder, decoder *json.Decoder, name string) error {
+	var (
+		err   error
+		token json.Token
+		start xml.StartElement = xmlElement(name)
+	)
+
+	if token, err = decoder.Token(); err != nil {
+		return err
+	}
+	if err = encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for err == nil && decoder.More() {
+			if token, err = decoder.Token(); err == nil {
+				err = jsonToXML(encoder, decoder, token.(string))
+			}
+		}
+		if err == nil {
+			_, err = decoder.Token()
+		}
+	case json.Delim('['):
+		for err == nil && decoder.More() {
+			err = jsonToXML(encoder, decoder, xmlItem)
+		}
+		if err == nil {
+			_, err = decoder.Token()
+		}
+	case nil:
+	default:
+		err = encoder.EncodeToken(xml.CharData(fmt.Sprint(token)))
+	}
+
+	if err != nil {
+		return err
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlElement returns start element of name, a name
+// which is not a valid element is put in key attribute
+func xmlElement(name string) xml.StartElement {
+	var valid bool = name != "" && !strings.HasPrefix(strings.ToLower(name), "xml")
+
+	for i, char := range name {
+		if char != '_' && !unicode.IsLetter(char) &&
+			(i == 0 || (char != '-' && char != '.' && !unicode.IsDigit(char))) {
+			valid = false
+		}
+	}
+
+	if !valid {
+		return xml.StartElement{
+			Name: xml.Name{Local: xmlEntry},
+			Attr: []xml.Attr{{Name: xml.Name{Local: xmlKey}, Value: name}},
+		}
+	}
+	return xml.StartElement{Name: xml.Name{Local: name}}
+}
+
+// ContentType implements Renderer ContentType
+func (MsgpackRenderer) ContentType() string {
+	return "application/msgpack"
+}
+
+// Render implements Renderer Render
+func (MsgpackRenderer) Render(w io.Writer, payload interface{}) error {
+	var encoder *msgpack.Encoder = msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(payload)
+}
+
+// ContentType implements Renderer ContentType
+func (CSVRenderer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// Render implements Renderer Render, data of Response is unwrapped
+func (r CSVRenderer) Render(w io.Writer, payload interface{}) error {
+	switch data := payload.(type) {
+	case Response:
+		payload = data.Data
+	case *Response:
+		payload = data.Data
+	}
+	return r.RenderData(w, payload)
+}
+
+// RenderData implements DataRenderer RenderData
+func (CSVRenderer) RenderData(w io.Writer, data interface{}) error {
+	var (
+		err     error
+		records [][]string
+		writer  *csv.Writer = csv.NewWriter(w)
+	)
+
+	if records, err = csvRecords(data); err != nil {
+		return err
+	}
+
+	writer.WriteAll(records)
+	return writer.Error()
+}
+
+// csvRecords converts data into csv header and rows
+func csvRecords(data interface{}) ([][]string, error) {
+	var (
+		i       int
+		value   reflect.Value
+		header  []string
+		row     []string
+		records [][]string
+	)
+
+	if rows, ok := data.([][]string); ok {
+		return rows, nil
+	}
+
+	value = reflect.Indirect(reflect.ValueOf(data))
+	if !value.IsValid() {
+		return nil, nil
+	}
+
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		header, row = csvRow(value, nil)
+		return [][]string{header, row}, nil
+	}
+
+	for i = 0; i < value.Len(); i++ {
+		if i == 0 {
+			header, _ = csvRow(value.Index(i), nil)
+			records = append(records, header)
+		}
+		_, row = csvRow(value.Index(i), header)
+		records = append(records, row)
+	}
+
+	return records, nil
+}
+
+// csvRow returns columns and cells of a struct or map value.
+// If columns is given the cells follow its order.
+func csvRow(value reflect.Value, columns []string) ([]string, []string) {
+	var (
+		column string
+		names  []string
+		cells  map[string]string = make(map[string]string)
+		row    []string
+	)
+
+	value = indirect(value)
+
+	switch value.Kind() {
+	case reflect.Struct:
+		names = csvStructCells(value, cells)
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			column = fmt.Sprint(key.Interface())
+			names = append(names, column)
+			cells[column] = csvCell(value.MapIndex(key))
+		}
+		sort.Strings(names)
+	default:
+		names = []string{"value"}
+		cells["value"] = csvCell(value)
+	}
+
+	if columns == nil {
+		columns = names
+	}
+	for _, column = range columns {
+		row = append(row, cells[column])
+	}
+
+	return names, row
+}
+
+// csvStructCells collects exported fields of value named by their
+// json tag, embedded structs are flattened
+func csvStructCells(value reflect.Value, cells map[string]string) []string {
+	var (
+		i     int
+		name  string
+		names []string
+		field reflect.StructField
+	)
+
+	for i = 0; i < value.NumField(); i++ {
+		field = value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name = strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" && indirect(value.Field(i)).Kind() == reflect.Struct {
+			names = append(names, csvStructCells(indirect(value.Field(i)), cells)...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+		cells[name] = csvCell(value.Field(i))
+	}
+
+	return names
+}
+
+// csvCell formats value as a csv cell, time is formatted as RFC 3339
+func csvCell(value reflect.Value) string {
+	value = indirect(value)
+
+	if !value.IsValid() {
+		return ""
+	}
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.IsNil() {
+		return ""
+	}
+	if value.Type() == timeType {
+		return value.Interface().(time.Time).Format(time.RFC3339)
+	}
+	if value.CanInterface() {
+		return fmt.Sprint(value.Interface())
+	}
+	return ""
+}
+
+// indirect dereferences pointers and interfaces of value
+func indirect(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -30,20 +29,26 @@ type (
 // ServeHTTP impementation of PageNotFound404
 func (e PageNotFound404) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(contentType, "application/json")
-	w.WriteHeader(http.StatusNotFound)
-	encoder := json.NewEncoder(w)
-	encoder.Encode(&Response{Message: MessagePageNotFound, Data: nil})
+	errorRenderer(w, r, MessagePageNotFound, nil, http.StatusNotFound)
 }
 
 // ServeHTTP impementation of MethodNotAllowed405
 func (e MethodNotAllowed405) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(contentType, "application/json")
-	w.WriteHeader(http.StatusMethodNotAllowed)
-	encoder := json.NewEncoder(w)
-	encoder.Encode(&Response{Message: MessageMethodNotAllowed, Data: nil})
+	errorRenderer(w, r, MessageMethodNotAllowed, nil, http.StatusMethodNotAllowed)
 }
 
 // Group create the sub router of path
 func Group(path string, parent *mux.Router) *mux.Router {
 	return parent.PathPrefix(path).Subrouter()
 }
+
+// chain wraps h with middlewares. The first middleware is the outermost
+// so they run in the given order, the same as mux.Router.Use
+func chain(h http.Handler, middlewares []mux.MiddlewareFunc) http.Handler {
+	var i int
+	for i = len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// trace returns a middleware which adds name to the X-Trace header
+func trace(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// traced answers with the X-Trace header of the route
+func traced(ctx *Context) interface{} {
+	ctx.Writer.Header().Add("X-Trace", "handler")
+	return ctx.Success(nil)
+}
+
+// serve sends a request to router and returns the X-Trace header
+func serve(t *testing.T, router http.Handler, method, path string) []string {
+	var w *httptest.ResponseRecorder = httptest.NewRecorder()
+
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s: status %d, want %d", method, path, w.Code, http.StatusOK)
+	}
+	return w.Header().Values("X-Trace")
+}
+
+func TestRouteMiddlewareScope(t *testing.T) {
+	var ctx *Context = New(JSONify)
+
+	ctx.GET("/sibling", traced)
+	ctx.GET("/scoped", traced, trace("scoped"))
+	ctx.POST("/later", traced)
+	ctx.REST("/resource", traced, trace("rest"))
+	ctx.GET("/last", traced)
+
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodGet, "/scoped", []string{"scoped", "handler"}},
+		{http.MethodGet, "/sibling", []string{"handler"}},
+		{http.MethodPost, "/later", []string{"handler"}},
+		{http.MethodGet, "/resource", []string{"rest", "handler"}},
+		{http.MethodDelete, "/resource/1", []string{"rest", "handler"}},
+		{http.MethodGet, "/last", []string{"handler"}},
+	}
+
+	for _, test := range tests {
+		if got := serve(t, ctx.Router, test.method, test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s %s: trace %v, want %v", test.method, test.path, got, test.want)
+		}
+	}
+}
+
+func TestRouteMiddlewareOrder(t *testing.T) {
+	var (
+		ctx *Context = New(JSONify, trace("router"))
+		sub *Context
+	)
+
+	ctx.Use(trace("use"))
+	ctx.GET("/ordered", traced, trace("first"), trace("second"), trace("third"))
+
+	sub = ctx.SubRouter("/api", trace("sub"))
+	sub.GET("/ordered", traced, trace("first"), trace("second"))
+
+	want := []string{"router", "use", "first", "second", "third", "handler"}
+	if got := serve(t, ctx.Router, http.MethodGet, "/ordered"); !reflect.DeepEqual(got, want) {
+		t.Errorf("trace %v, want %v", got, want)
+	}
+
+	want = []string{"router", "use", "sub", "first", "second", "handler"}
+	if got := serve(t, ctx.Router, http.MethodGet, "/api/ordered"); !reflect.DeepEqual(got, want) {
+		t.Errorf("sub router trace %v, want %v", got, want)
+	}
+}
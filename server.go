@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type (
+	// StartHook is called before the server starts accepting connections.
+	// Returning an error aborts the start up.
+	StartHook func() error
+
+	// ShutdownHook is called after the server has stopped accepting
+	// connections and in-flight requests were drained
+	ShutdownHook func(context.Context) error
+
+	// lifecycle holds server state shared by a Context and its sub routers
+	lifecycle struct {
+		onStart         []StartHook
+		onShutdown      []ShutdownHook
+		shutdownTimeout time.Duration
+	}
+)
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+}
+
+// OnStart appends hooks which are called, in the order they were
+// registered, before the server starts listening
+func (c *Context) OnStart(hooks ...StartHook) {
+	c.getLifecycle().onStart = append(c.getLifecycle().onStart, hooks...)
+}
+
+// OnShutdown appends hooks which are called, in the order they were
+// registered, once the server has been shut down. All gorm and redis
+// connections are closed after the last hook returns.
+func (c *Context) OnShutdown(hooks ...ShutdownHook) {
+	c.getLifecycle().onShutdown = append(c.getLifecycle().onShutdown, hooks...)
+}
+
+// ShutdownTimeout sets how long Serve waits for in-flight requests
+// to complete after receiving SIGINT or SIGTERM. Default is 15 seconds.
+func (c *Context) ShutdownTimeout(timeout time.Duration) {
+	c.getLifecycle().shutdownTimeout = timeout
+}
+
+func (c *Context) getLifecycle() *lifecycle {
+	if c.lifecycle == nil {
+		c.lifecycle = newLifecycle()
+	}
+	return c.lifecycle
+}
+
+// NewServerOptions returns default server options. Only header read
+// and idle connections are timed out by default to prevent slowloris
+// attacks, set ReadTimeout and WriteTimeout to fit your handlers.
+func NewServerOptions() *ServerOptions {
+	var opt ServerOptions
+
+	opt.ReadHeaderTimeout = defaultReadHeaderTimeout
+	opt.IdleTimeout = defaultIdleTimeout
+	opt.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	opt.CertReloadInterval = defaultCertReloadInterval
+
+	return &opt
+}
+
+// newServer creates http.Server listen on port with opt settings, zero
+// header read and idle timeouts use the defaults of NewServerOptions
+func newServer(port int, router http.Handler, opt *ServerOptions) *http.Server {
+	var server *http.Server
+
+	if opt == nil {
+		opt = NewServerOptions()
+	}
+
+	server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           router,
+		ReadTimeout:       opt.ReadTimeout,
+		ReadHeaderTimeout: opt.ReadHeaderTimeout,
+		WriteTimeout:      opt.WriteTimeout,
+		IdleTimeout:       opt.IdleTimeout,
+		MaxHeaderBytes:    opt.MaxHeaderBytes,
+		TLSConfig:         opt.TLSConfig,
+	}
+
+	// a hand-built opt must not leave slowloris attacks open
+	if server.ReadHeaderTimeout <= 0 {
+		server.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if server.IdleTimeout <= 0 {
+		server.IdleTimeout = defaultIdleTimeout
+	}
+
+	return server
+}
+
+// Serve listen on port with default server options and handle
+// graceful shutdown on SIGINT or SIGTERM
+func (c *Context) Serve(port int) error {
+	return c.ServeWithOptions(port, nil)
+}
+
+// ServeWith listen on port using router as handler and handle
+// graceful shutdown on SIGINT or SIGTERM
+func (c *Context) ServeWith(port int, router http.Handler) error {
+	var server *http.Server = newServer(port, router, nil)
+	return c.run(server, server.ListenAndServe)
+}
+
+// ServeWithOptions listen on port with opt settings and handle
+// graceful shutdown on SIGINT or SIGTERM. If opt.TLSConfig holds
+// any certificate the server listens on HTTPS.
+func (c *Context) ServeWithOptions(port int, opt *ServerOptions) error {
+	var server *http.Server = newServer(port, c.Router, opt)
+
+	if server.TLSConfig != nil &&
+		(len(server.TLSConfig.Certificates) > 0 || server.TLSConfig.GetCertificate != nil) {
+		return c.run(server, func() error {
+			return server.ListenAndServeTLS("", "")
+		})
+	}
+
+	return c.run(server, server.ListenAndServe)
+}
+
+// ServeTLS listen on port for HTTPS using the key pair from certFile and
+// keyFile. The key pair is reloaded every opt.CertReloadInterval when one
+// of the files has changed, so renewed certificates apply without restart.
+func (c *Context) ServeTLS(port int, certFile, keyFile string, opt *ServerOptions) error {
+	var (
+		err      error
+		server   *http.Server
+		reloader *certReloader
+		interval time.Duration = defaultCertReloadInterval
+	)
+
+	if reloader, err = newCertReloader(certFile, keyFile); err != nil {
+		return err
+	}
+	defer reloader.close()
+
+	server = newServer(port, c.Router, opt)
+	if server.TLSConfig == nil {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		server.TLSConfig = server.TLSConfig.Clone()
+	}
+	server.TLSConfig.Certificates = nil
+	server.TLSConfig.GetCertificate = reloader.GetCertificate
+
+	if opt != nil && opt.CertReloadInterval > 0 {
+		interval = opt.CertReloadInterval
+	}
+	go reloader.watch(interval)
+
+	return c.run(server, func() error {
+		return server.ListenAndServeTLS("", "")
+	})
+}
+
+// run calls start hooks, starts listen and waits for a stop signal
+// before draining the server and calling shutdown hooks.
+// Returns nil on an orderly shutdown.
+func (c *Context) run(server *http.Server, listen func() error) error {
+	var (
+		err  error
+		hook StartHook
+		errs chan error     = make(chan error, 1)
+		quit chan os.Signal = make(chan os.Signal, 1)
+		lc   *lifecycle     = c.getLifecycle()
+	)
+
+	for _, hook = range lc.onStart {
+		if err = hook(); err != nil {
+			return DescError(err)
+		}
+	}
+
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	go func() {
+		errs <- listen()
+	}()
+
+	select {
+	case err = <-errs:
+		// server failed to start or stopped unexpectedly
+		if err != http.ErrServerClosed {
+			lc.shutdown(context.Background())
+			return err
+		}
+	case <-quit:
+		Logger("server is shutting down")
+	}
+
+	return lc.drain(server)
+}
+
+// drain shuts down server within shutdownTimeout then calls shutdown hooks.
+// Hooks get their own shutdownTimeout so a slow drain does not cancel them.
+func (lc *lifecycle) drain(server *http.Server) error {
+	var (
+		err     error
+		hookErr error
+		ctx     context.Context
+		cancel  context.CancelFunc
+	)
+
+	ctx, cancel = context.WithTimeout(context.Background(), lc.shutdownTimeout)
+	defer cancel()
+
+	if err = server.Shutdown(ctx); err != nil {
+		Logger(DescError(err))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), lc.shutdownTimeout)
+	defer cancel()
+
+	hookErr = lc.shutdown(ctx)
+	if err == nil {
+		err = hookErr
+	}
+
+	return err
+}
+
+// shutdown calls every shutdown hook in order then closes all connections.
+// Returns the first error that occurred.
+func (lc *lifecycle) shutdown(ctx context.Context) error {
+	var (
+		err      error
+		firstErr error
+		hook     ShutdownHook
+	)
+
+	for _, hook = range lc.onShutdown {
+		if err = hook(ctx); err != nil {
+			Logger(DescError(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if err = CloseConnections(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// CloseConnections closes every registered gorm v2, gorm v1 and redis
+// connection. Returns the first error that occurred.
+func CloseConnections() error {
+	var (
+		err      error
+		firstErr error
+		closers  []func() error = []func() error{closeGormDBs, closeGormDBsv1, closeRedis}
+		closer   func() error
+	)
+
+	for _, closer = range closers {
+		if err = closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
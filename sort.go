@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"gorm.io/gorm"
+)
+
+type (
+	// SortColumn whitelists a sort key, see FilteredColumn Sorts
+	SortColumn struct {
+		// Column is the column of the key, default is the key name
+		Column string
+		// Nulls places NULL values first or last, NULLS FIRST/LAST is
+		// used on postgres and emulated by CASE on other dialects
+		Nulls SortNulls
+	}
+
+	// SortNulls is where NULL values are sorted
+	SortNulls int
+
+	// sortKey is a parsed key of the sort parameter
+	sortKey struct {
+		name       string
+		column     string
+		descending bool
+		nulls      SortNulls
+	}
+)
+
+// NULL placements of SortColumn
+const (
+	// SortNullsDefault keeps the placement of the dialect
+	SortNullsDefault SortNulls = iota
+
+	// SortNullsFirst sorts NULL values before the others
+	SortNullsFirst
+
+	// SortNullsLast sorts NULL values after the others
+	SortNullsLast
+)
+
+// ValidateSort checks the sort parameter of urlQuery against
+// columns.Sorts. Errors are returned as validation.Errors of "sort"
+// so they can be sent as 400-bad request. Pagination and
+// CursorPagination fail with the same error.
+func ValidateSort(urlQuery URLQuery, columns *FilteredColumn) error {
+	if _, err := sortKeys(urlQuery, columns); err != nil {
+		return DescError(err)
+	}
+	return nil
+}
+
+// sortKeys parses sort of urlQuery, e.g. -created_at,name. Without sort
+// the rows are ordered by columns.OrderBy and the deprecated Descending.
+func sortKeys(urlQuery URLQuery, columns *FilteredColumn) ([]sortKey, error) {
+	var (
+		ok   bool
+		raw  string = strings.TrimSpace(urlQuery.Sort)
+		name string
+		seen map[string]bool = make(map[string]bool)
+		key  sortKey
+		keys []sortKey
+		spec SortColumn
+	)
+
+	if columns == nil {
+		columns = &FilteredColumn{}
+	}
+
+	if raw == "" {
+		if columns.OrderBy == "" {
+			return nil, nil
+		}
+		return []sortKey{{
+			name:       columns.OrderBy,
+			column:     columns.OrderBy,
+			descending: strings.ToLower(urlQuery.Descending) == logicalTrue,
+		}}, nil
+	}
+
+	if strings.Count(raw, ",") >= maxSortKeys {
+		return nil, validation.Errors{"sort": fmt.Errorf(tooManySortKeys, maxSortKeys)}
+	}
+
+	for _, name = range strings.Split(raw, ",") {
+		key = sortKey{}
+		name = strings.TrimSpace(name)
+
+		switch {
+		case strings.HasPrefix(name, "-"):
+			key.descending, name = true, name[1:]
+		case strings.HasPrefix(name, "+"):
+			name = name[1:]
+		}
+
+		if spec, ok = columns.Sorts[name]; !ok || name == "" {
+			return nil, validation.Errors{"sort": fmt.Errorf(sortNotAllowed, name)}
+		}
+		if seen[name] {
+			return nil, validation.Errors{"sort": errors.New(duplicateSortKey)}
+		}
+		seen[name] = true
+
+		key.name, key.column, key.nulls = name, spec.Column, spec.Nulls
+		if key.column == "" {
+			key.column = name
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// applySort orders db by the sort of urlQuery, an
+// invalid sort is added to the errors of db
+func applySort(db *gorm.DB, urlQuery URLQuery, columns *FilteredColumn) *gorm.DB {
+	var (
+		err  error
+		key  sortKey
+		keys []sortKey
+	)
+
+	if keys, err = sortKeys(urlQuery, columns); err != nil {
+		db.AddError(DescError(err))
+		return db
+	}
+
+	for _, key = range keys {
+		db = db.Order(orderClause(db, key, false))
+	}
+	return db
+}
+
+// orderClause returns ORDER BY expression of key,
+// reverse flips the direction and the NULL placement
+func orderClause(db *gorm.DB, key sortKey, reverse bool) string {
+	var (
+		descending bool      = key.descending != reverse
+		nulls      SortNulls = key.nulls
+		direction  string    = " ASC"
+	)
+
+	if descending {
+		direction = " DESC"
+	}
+
+	if reverse {
+		switch nulls {
+		case SortNullsFirst:
+			nulls = SortNullsLast
+		case SortNullsLast:
+			nulls = SortNullsFirst
+		}
+	}
+
+	switch {
+	case nulls == SortNullsDefault:
+		return key.column + direction
+	case db.Dialector.Name() == "postgres" && nulls == SortNullsFirst:
+		return key.column + direction + " NULLS FIRST"
+	case db.Dialector.Name() == "postgres":
+		return key.column + direction + " NULLS LAST"
+	case nulls == SortNullsFirst:
+		return "CASE WHEN " + key.column + " IS NULL THEN 0 ELSE 1 END, " + key.column + direction
+	default:
+		return "CASE WHEN " + key.column + " IS NULL THEN 1 ELSE 0 END, " + key.column + direction
+	}
+}
+
+// sortString returns keys as the sort parameter
+func sortString(keys []sortKey) string {
+	var names []string
+
+	for _, key := range keys {
+		if key.descending {
+			names = append(names, "-"+key.name)
+		} else {
+			names = append(names, key.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
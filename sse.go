@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Event is a server-sent event. Data of type string or []byte is
+	// sent as is, other types are JSON encoded.
+	Event struct {
+		ID    string
+		Event string
+		Data  interface{}
+		Retry time.Duration
+	}
+
+	// SSEOptions configure Context.SSEWith
+	SSEOptions struct {
+		// Heartbeat sends a comment every interval to keep the
+		// connection alive, zero disables it
+		Heartbeat time.Duration
+		// Retry tells the client how long to wait before reconnecting,
+		// zero keeps the browser default
+		Retry time.Duration
+	}
+
+	// EventStream writes server-sent events to the client.
+	// It is safe for concurrent use.
+	EventStream struct {
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		once        sync.Once
+		writer      http.ResponseWriter
+		flusher     http.Flusher
+		done        chan struct{}
+		lastEventID string
+	}
+)
+
+// NewSSEOptions returns default SSEOptions,
+// a heartbeat is sent every 15 seconds
+func NewSSEOptions() *SSEOptions {
+	return &SSEOptions{
+		Heartbeat: defaultSSEHeartbeat,
+	}
+}
+
+// SSE starts an event stream with default SSEOptions. See SSEWith.
+func (c *Context) SSE() (*EventStream, error) {
+	return c.SSEWith(nil)
+}
+
+// SSEWith starts an event stream on the response. The stream is closed
+// when the client disconnects, when Close is called or when the handler
+// returns. Note that WriteTimeout of ServerOptions also ends the stream.
+//
+//	stream, err := ctx.SSE()
+//	if err != nil {
+//		return ctx.InternalServerError(err)
+//	}
+//	defer stream.Close()
+func (c *Context) SSEWith(opt *SSEOptions) (*EventStream, error) {
+	var (
+		err     error
+		ok      bool
+		flusher http.Flusher
+		stream  *EventStream
+	)
+
+	if opt == nil {
+		opt = NewSSEOptions()
+	}
+
+	if flusher, ok = c.Writer.(http.Flusher); !ok || !canFlush(c.Writer) {
+		return nil, &Error{Description: streamingUnsupported}
+	}
+
+	if c.Written() {
+		return nil, ErrAlreadyWritten
+	}
+
+	stream = &EventStream{
+		writer:      c.Writer,
+		flusher:     flusher,
+		done:        make(chan struct{}),
+		lastEventID: c.Request.Header.Get("Last-Event-ID"),
+	}
+
+	// override JSONify and any other content type
+	c.Writer.Header().Set(contentType, "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Header().Del(contentLength)
+	c.Writer.WriteHeader(http.StatusOK)
+
+	if opt.Retry > 0 {
+		if err = stream.write(fmt.Sprintf("retry: %d\n\n", opt.Retry.Milliseconds())); err != nil {
+			return nil, err
+		}
+	} else {
+		flusher.Flush()
+	}
+
+	stream.wg.Add(1)
+	go stream.watch(c.requestContext(), opt.Heartbeat)
+
+	c.stream = stream
+	return stream, nil
+}
+
+// watch sends heartbeats until the stream or the request is done
+func (s *EventStream) watch(ctx context.Context, heartbeat time.Duration) {
+	var tick <-chan time.Time
+
+	defer s.wg.Done()
+
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.once.Do(func() { close(s.done) })
+			return
+		case <-s.done:
+			return
+		case <-tick:
+			if err := s.write(": ping\n\n"); err != nil {
+				s.once.Do(func() { close(s.done) })
+				return
+			}
+		}
+	}
+}
+
+// LastEventID returns Last-Event-ID header sent by a reconnecting client
+// so the stream can resume after it
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed when the stream ends
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes event to the client
+func (s *EventStream) Send(event Event) error {
+	var (
+		err    error
+		data   string
+		line   string
+		buffer bytes.Buffer
+	)
+
+	if data, err = eventData(event.Data); err != nil {
+		return DescError(err)
+	}
+
+	if event.ID != "" {
+		fmt.Fprintf(&buffer, "id: %s\n", singleLine(event.ID))
+	}
+	if event.Event != "" {
+		fmt.Fprintf(&buffer, "event: %s\n", singleLine(event.Event))
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&buffer, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	// "\r" alone ends a line too, it must not start a new field
+	for _, line = range strings.Split(lineBreaks.Replace(data), "\n") {
+		fmt.Fprintf(&buffer, "data: %s\n", line)
+	}
+	buffer.WriteString("\n")
+
+	return s.write(buffer.String())
+}
+
+// Close ends the stream and stops the heartbeat. No event
+// is written once Close returns.
+func (s *EventStream) Close() {
+	s.once.Do(func() { close(s.done) })
+	s.wg.Wait()
+
+	// wait for a pending write
+	s.mu.Lock()
+	s.mu.Unlock()
+}
+
+// write sends raw to the client and flushes it
+func (s *EventStream) write(raw string) error {
+	var err error
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return &errStreamClosed
+	default:
+	}
+
+	if _, err = s.writer.Write([]byte(raw)); err != nil {
+		return DescError(err)
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// eventData formats data of an event
+func eventData(data interface{}) (string, error) {
+	switch value := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case []byte:
+		return string(value), nil
+	default:
+		raw, err := json.Marshal(value)
+		return string(raw), err
+	}
+}
+
+// lineBreaks normalizes the line terminators of event data to "\n"
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// singleLine strips line breaks of an event field
+func singleLine(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSESendLineBreaks(t *testing.T) {
+	var (
+		ctx *Context = New()
+		w   *httptest.ResponseRecorder
+	)
+
+	ctx.GET("/events", func(c *Context) interface{} {
+		stream, err := c.SSEWith(&SSEOptions{})
+		if err != nil {
+			return c.InternalServerError(err)
+		}
+		defer stream.Close()
+
+		for _, data := range []string{"x\revent: admin\rid: 9", "a\r\nb\nc", "line\r"} {
+			if err = stream.Send(Event{Event: "message", Data: data}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	w = httptest.NewRecorder()
+	ctx.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	want := "event: message\ndata: x\ndata: event: admin\ndata: id: 9\n\n" +
+		"event: message\ndata: a\ndata: b\ndata: c\n\n" +
+		"event: message\ndata: line\ndata: \n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("stream %q, want %q", got, want)
+	}
+}
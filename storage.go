@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Storage persists uploaded files by name. Names use forward
+	// slashes and are cleaned so they cannot escape the storage root.
+	Storage interface {
+		// Put writes r as name, replacing it if it exists
+		Put(ctx context.Context, name string, r io.Reader) (int64, error)
+		// Open returns reader of name
+		Open(ctx context.Context, name string) (io.ReadCloser, error)
+		// Size returns size of name in bytes
+		Size(ctx context.Context, name string) (int64, error)
+		// Delete removes name, a missing name is not an error
+		Delete(ctx context.Context, name string) error
+	}
+
+	// ChunkStorage is a Storage which can append to a file,
+	// it is required by resumable uploads
+	ChunkStorage interface {
+		Storage
+		// Append writes r at the end of name and returns the number
+		// of bytes written, even if it fails halfway
+		Append(ctx context.Context, name string, r io.Reader) (int64, error)
+		// List returns the names of the files under dir and its
+		// subdirectories, a missing dir is empty
+		List(ctx context.Context, dir string) ([]string, error)
+	}
+
+	// LocalStorage stores files under Dir of the local filesystem
+	LocalStorage struct {
+		Dir string
+	}
+
+	// MemoryStorage stores files in memory, it is meant for tests
+	MemoryStorage struct {
+		mu    sync.RWMutex
+		files map[string][]byte
+	}
+)
+
+// NewLocalStorage returns LocalStorage of dir, dir is created if needed
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, DescError(err)
+	}
+	return &LocalStorage{Dir: dir}, nil
+}
+
+// Path returns the file path of name, e.g. for Context.SendFile
+func (s *LocalStorage) Path(name string) (string, error) {
+	if name = cleanName(name); name == "" {
+		return "", &Error{Description: invalidFileName}
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(name)), nil
+}
+
+// Put implements Storage Put, the file is written atomically
+func (s *LocalStorage) Put(ctx context.Context, name string, r io.Reader) (int64, error) {
+	var (
+		err    error
+		size   int64
+		target string
+		file   *os.File
+	)
+
+	if target, err = s.Path(name); err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	if file, err = os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp"); err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	if size, err = io.Copy(file, contextReader{ctx, r}); err != nil {
+		file.Close()
+		return size, err
+	}
+	if err = file.Close(); err != nil {
+		return size, err
+	}
+
+	return size, os.Rename(file.Name(), target)
+}
+
+// Append implements ChunkStorage Append, name must exist
+func (s *LocalStorage) Append(ctx context.Context, name string, r io.Reader) (int64, error) {
+	var (
+		err    error
+		size   int64
+		target string
+		file   *os.File
+	)
+
+	if target, err = s.Path(name); err != nil {
+		return 0, err
+	}
+	if file, err = os.OpenFile(target, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		return 0, err
+	}
+
+	size, err = io.Copy(file, contextReader{ctx, r})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
+// Open implements Storage Open, the reader is an *os.File
+func (s *LocalStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	var (
+		err    error
+		target string
+	)
+
+	if target, err = s.Path(name); err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+// Size implements Storage Size
+func (s *LocalStorage) Size(ctx context.Context, name string) (int64, error) {
+	var (
+		err    error
+		target string
+		info   os.FileInfo
+	)
+
+	if target, err = s.Path(name); err != nil {
+		return 0, err
+	}
+	if info, err = os.Stat(target); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Delete implements Storage Delete
+func (s *LocalStorage) Delete(ctx context.Context, name string) error {
+	var (
+		err    error
+		target string
+	)
+
+	if target, err = s.Path(name); err != nil {
+		return err
+	}
+	if err = os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements ChunkStorage List
+func (s *LocalStorage) List(ctx context.Context, dir string) ([]string, error) {
+	var (
+		err   error
+		root  string = s.Dir
+		names []string
+	)
+
+	if dir = cleanName(dir); dir != "" {
+		root = filepath.Join(s.Dir, filepath.FromSlash(dir))
+	}
+
+	err = filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctx != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.Type().IsRegular() {
+			name, _ = filepath.Rel(s.Dir, name)
+			names = append(names, filepath.ToSlash(name))
+		}
+		return nil
+	})
+
+	return names, err
+}
+
+// NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string][]byte),
+	}
+}
+
+// Put implements Storage Put
+func (s *MemoryStorage) Put(ctx context.Context, name string, r io.Reader) (int64, error) {
+	var (
+		err    error
+		size   int64
+		buffer bytes.Buffer
+	)
+
+	if name = cleanName(name); name == "" {
+		return 0, &Error{Description: invalidFileName}
+	}
+	if size, err = io.Copy(&buffer, contextReader{ctx, r}); err != nil {
+		return size, err
+	}
+
+	s.mu.Lock()
+	s.files[name] = buffer.Bytes()
+	s.mu.Unlock()
+
+	return size, nil
+}
+
+// Append implements ChunkStorage Append, name must exist
+func (s *MemoryStorage) Append(ctx context.Context, name string, r io.Reader) (int64, error) {
+	var (
+		err    error
+		ok     bool
+		size   int64
+		buffer bytes.Buffer
+	)
+
+	name = cleanName(name)
+
+	s.mu.RLock()
+	_, ok = s.files[name]
+	s.mu.RUnlock()
+	if !ok {
+		return 0, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	// keep what has been read when r fails
+	size, err = io.Copy(&buffer, contextReader{ctx, r})
+
+	s.mu.Lock()
+	s.files[name] = append(s.files[name], buffer.Bytes()...)
+	s.mu.Unlock()
+
+	return size, err
+}
+
+// Open implements Storage Open
+func (s *MemoryStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	var (
+		ok   bool
+		data []byte
+	)
+
+	s.mu.RLock()
+	data, ok = s.files[cleanName(name)]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Size implements Storage Size
+func (s *MemoryStorage) Size(ctx context.Context, name string) (int64, error) {
+	var (
+		ok   bool
+		data []byte
+	)
+
+	s.mu.RLock()
+	data, ok = s.files[cleanName(name)]
+	s.mu.RUnlock()
+
+	if !ok {
+		return 0, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return int64(len(data)), nil
+}
+
+// List implements ChunkStorage List
+func (s *MemoryStorage) List(ctx context.Context, dir string) ([]string, error) {
+	var (
+		name  string
+		names []string
+	)
+
+	if dir = cleanName(dir); dir != "" {
+		dir += "/"
+	}
+
+	s.mu.RLock()
+	for name = range s.files {
+		if strings.HasPrefix(name, dir) {
+			names = append(names, name)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete implements Storage Delete
+func (s *MemoryStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	delete(s.files, cleanName(name))
+	s.mu.Unlock()
+
+	return nil
+}
+
+// cleanName returns name relative to the storage root,
+// empty if name does not refer to a file
+func cleanName(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))[1:]
+	if name == "" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements io.Reader Read
+func (r contextReader) Read(p []byte) (int, error) {
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// StreamFormat is the output format of Context.Stream
+	StreamFormat string
+
+	// StreamOptions configure Context.StreamWith
+	StreamOptions struct {
+		// Format of the output, when empty NDJSON is used if the
+		// request accepts application/x-ndjson otherwise JSON array
+		Format StreamFormat
+		// FlushEvery flushes the response every FlushEvery rows,
+		// zero or less uses the default of 100
+		FlushEvery int
+	}
+)
+
+const (
+	// StreamNDJSON writes one JSON document per line
+	StreamNDJSON StreamFormat = "application/x-ndjson"
+
+	// StreamJSONArray writes rows as a chunked JSON array
+	StreamJSONArray StreamFormat = "application/json"
+)
+
+// NewStreamOptions returns default StreamOptions,
+// the response is flushed every 100 rows
+func NewStreamOptions() *StreamOptions {
+	return &StreamOptions{
+		FlushEvery: defaultStreamFlushEvery,
+	}
+}
+
+// Stream writes rows of query with default StreamOptions. See StreamWith.
+func (c *Context) Stream(query *gorm.DB, model interface{}) interface{} {
+	return c.StreamWith(query, model, nil)
+}
+
+// StreamWith writes rows of query one at a time instead of loading the
+// whole result set. model is the row type, e.g. &User{}, nil uses the
+// Model of query. The query is bound to the request context so it
+// stops when the client disconnects.
+// Each row is written as soon as it is scanned, the response is flushed
+// every opt.FlushEvery rows. Rows are written without envelope, an error
+// after the first row ends the output early and is only logged.
+//
+//	return ctx.Stream(db.Where("active = ?", true), &User{})
+func (c *Context) StreamWith(query *gorm.DB, model interface{}, opt *StreamOptions) interface{} {
+	var (
+		err       error
+		count     int
+		rows      *sql.Rows
+		rowType   reflect.Type
+		row       interface{}
+		line      []byte
+		format    StreamFormat
+		flusher   http.Flusher
+		flushable bool
+		every     int = defaultStreamFlushEvery
+	)
+
+	if opt == nil {
+		opt = NewStreamOptions()
+	}
+	if opt.FlushEvery > 0 {
+		every = opt.FlushEvery
+	}
+
+	if c.Written() {
+		return ErrAlreadyWritten
+	}
+
+	if format = opt.Format; format == "" {
+		format = negotiateStream(c.Request)
+	}
+
+	if model == nil {
+		model = query.Statement.Model
+	}
+	if model == nil {
+		return c.InternalServerError(&Error{Description: modelNotSet})
+	}
+
+	rowType = reflect.TypeOf(model)
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	query = query.WithContext(c.requestContext())
+	if query.Statement.Model == nil && query.Statement.Table == "" {
+		query = query.Model(model)
+	}
+
+	if rows, err = query.Rows(); err != nil {
+		return c.InternalServerError(DescError(err))
+	}
+	defer rows.Close()
+
+	flusher, flushable = c.Writer.(http.Flusher)
+	flushable = flushable && canFlush(c.Writer)
+
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Writer.Header().Set(contentType, string(format))
+	c.Writer.Header().Del(contentLength)
+	c.Writer.WriteHeader(http.StatusOK)
+
+	if format == StreamJSONArray {
+		_, err = c.Writer.Write([]byte("["))
+	}
+
+	for err == nil && rows.Next() {
+		// the driver stops on cancellation too, this ends it early
+		if err = c.requestContext().Err(); err != nil {
+			break
+		}
+
+		row = reflect.New(rowType).Interface()
+		if err = query.ScanRows(rows, row); err != nil {
+			break
+		}
+
+		if line, err = json.Marshal(row); err != nil {
+			break
+		}
+
+		switch {
+		case format == StreamNDJSON:
+			line = append(line, '\n')
+		case count > 0:
+			line = append([]byte(","), line...)
+		}
+
+		if _, err = c.Writer.Write(line); err != nil {
+			break
+		}
+		count++
+
+		if flushable && count%every == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		// the status has been sent, leave the output incomplete
+		err = DescError(err)
+		Logger(err)
+		return err
+	}
+
+	if format == StreamJSONArray {
+		c.Writer.Write([]byte("]"))
+	}
+	if flushable {
+		flusher.Flush()
+	}
+
+	Logger(Response{Message: MessageOK, Data: count})
+	return count
+}
+
+// negotiateStream returns NDJSON if r accepts it, otherwise JSON array
+func negotiateStream(r *http.Request) StreamFormat {
+	var accept acceptRange
+
+	for _, accept = range parseAccept(r.Header.Get("Accept")) {
+		switch accept.mediaType {
+		case string(StreamNDJSON), "application/ndjson", "application/jsonl":
+			return StreamNDJSON
+		case string(StreamJSONArray):
+			return StreamJSONArray
+		}
+	}
+	return StreamJSONArray
+}
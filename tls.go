@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader keeps a tls.Certificate loaded from certFile and keyFile
+// and reloads it whenever one of the files is modified
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// newCertReloader loads the key pair and returns its reloader
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	var (
+		err      error
+		reloader *certReloader = &certReloader{
+			certFile: certFile,
+			keyFile:  keyFile,
+			stop:     make(chan struct{}),
+		}
+	)
+
+	if err = reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// lastModified returns the latest modification time of certFile and keyFile
+func (cr *certReloader) lastModified() (time.Time, error) {
+	var (
+		err      error
+		certInfo os.FileInfo
+		keyInfo  os.FileInfo
+	)
+
+	if certInfo, err = os.Stat(cr.certFile); err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo, err = os.Stat(cr.keyFile); err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+// load reads the key pair from disk
+func (cr *certReloader) load() error {
+	var (
+		err     error
+		cert    tls.Certificate
+		modTime time.Time
+	)
+
+	if modTime, err = cr.lastModified(); err != nil {
+		return DescError(err)
+	}
+
+	if cert, err = tls.LoadX509KeyPair(cr.certFile, cr.keyFile); err != nil {
+		return DescError(err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.mu.Unlock()
+
+	return nil
+}
+
+// watch checks the key pair every interval until close is called.
+// A failed reload is logged and the previous certificate is kept.
+func (cr *certReloader) watch(interval time.Duration) {
+	var (
+		err     error
+		modTime time.Time
+		ticker  *time.Ticker = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cr.stop:
+			return
+		case <-ticker.C:
+			if modTime, err = cr.lastModified(); err != nil {
+				Logger(DescError(err))
+				continue
+			}
+
+			cr.mu.RLock()
+			changed := !modTime.Equal(cr.modTime)
+			cr.mu.RUnlock()
+
+			if !changed {
+				continue
+			}
+
+			if err = cr.load(); err != nil {
+				Logger(err)
+				continue
+			}
+			Logger("tls certificate reloaded: " + cr.certFile)
+		}
+	}
+}
+
+// close stops the watcher
+func (cr *certReloader) close() {
+	cr.once.Do(func() {
+		close(cr.stop)
+	})
+}
+
+// GetCertificate implements tls.Config GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
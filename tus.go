@@ -0,0 +1,557 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// TusOptions configure Context.Tus
+	TusOptions struct {
+		// Storage keeps the chunks and the state of uploads, it is required
+		Storage ChunkStorage
+		// MaxSize limits Upload-Length in bytes, zero means no limit
+		MaxSize int64
+		// Expiration of an incomplete upload since its last chunk,
+		// zero disables expiration
+		Expiration time.Duration
+		// Dir is prepended to the name of uploads in Storage
+		Dir string
+		// OnComplete is called after the last chunk has been written. An
+		// error fails the request and OnComplete is called again by the
+		// next PATCH or HEAD until it succeeds. It must not write the response.
+		OnComplete func(ctx *Context, upload *TusUpload) error
+	}
+
+	// TusUpload is the state of a resumable upload
+	TusUpload struct {
+		ID        string            `json:"id"`
+		Name      string            `json:"name"`
+		Length    int64             `json:"length"`
+		Offset    int64             `json:"offset"`
+		Metadata  map[string]string `json:"metadata,omitempty"`
+		ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+		// Completed is set once OnComplete has succeeded
+		Completed bool `json:"completed"`
+	}
+
+	// TusServer handles the tus routes of a path, see Context.Tus
+	TusServer struct {
+		opt *TusOptions
+		// busy holds the uploads being written by a request
+		mu   sync.Mutex
+		busy map[string]bool
+	}
+)
+
+// NewTusOptions returns default TusOptions of storage,
+// incomplete uploads expire after 24 hours
+func NewTusOptions(storage ChunkStorage) *TusOptions {
+	return &TusOptions{
+		Storage:    storage,
+		Expiration: defaultTusExpiration,
+	}
+}
+
+// Tus mounts a tus 1.0.0 resumable upload server on path with the
+// creation, creation-with-upload, expiration and termination extensions.
+// Uploads are created by POST path and written by PATCH path/{id}.
+// Middlewares only wrap these routes, see GET. The returned server
+// removes abandoned uploads with Purge.
+//
+//	files := goHandler.SubRouter("/files")
+//	files.Tus("", handler.NewTusOptions(storage))
+func (c *Context) Tus(path string, opt *TusOptions, middlewares ...mux.MiddlewareFunc) *TusServer {
+	var server *TusServer = &TusServer{opt: opt, busy: make(map[string]bool)}
+
+	if opt == nil || opt.Storage == nil {
+		panic(storageNotSet)
+	}
+
+	c.addRoute(http.MethodOptions, path, server.options, middlewares)
+	c.addRoute(post, path, server.create, middlewares)
+	c.addRoute(http.MethodOptions, path+tusID, server.options, middlewares)
+	c.addRoute(http.MethodHead, path+tusID, server.head, middlewares)
+	c.addRoute(patch, path+tusID, server.patch, middlewares)
+	c.addRoute(methodDelete, path+tusID, server.terminate, middlewares)
+
+	return server
+}
+
+// Purge removes the expired uploads of Storage and returns how many
+// were removed. Uploads being written are skipped. Expired uploads are
+// otherwise only removed when a client accesses them, so Purge should
+// run periodically, e.g.
+//
+//	go func() {
+//		for range time.Tick(time.Hour) {
+//			server.Purge(context.Background())
+//		}
+//	}()
+func (s *TusServer) Purge(ctx context.Context) (int, error) {
+	var (
+		err      error
+		firstErr error
+		removed  int
+		name     string
+		names    []string
+		upload   *TusUpload
+	)
+
+	if names, err = s.opt.Storage.List(ctx, cleanName(s.opt.Dir)); err != nil {
+		return 0, DescError(err)
+	}
+
+	for _, name = range names {
+		if !strings.HasSuffix(name, tusInfoSuffix) {
+			continue
+		}
+		name = strings.TrimSuffix(name, tusInfoSuffix)
+		if !tusIDPattern.MatchString(path.Base(name)) || !s.lock(path.Base(name)) {
+			continue
+		}
+
+		if upload, err = s.read(ctx, name); err == nil && upload.expired() {
+			if err = s.remove(ctx, upload); err == nil {
+				removed++
+			}
+		}
+		s.unlock(path.Base(name))
+
+		if err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = DescError(err)
+		}
+	}
+
+	return removed, firstErr
+}
+
+// options answers the tus discovery request
+func (s *TusServer) options(ctx *Context) interface{} {
+	ctx.Writer.Header().Set("Tus-Resumable", tusVersion)
+	ctx.Writer.Header().Set("Tus-Version", tusVersion)
+	ctx.Writer.Header().Set("Tus-Extension", tusExtensions)
+	if s.opt.MaxSize > 0 {
+		ctx.Writer.Header().Set("Tus-Max-Size", strconv.FormatInt(s.opt.MaxSize, 10))
+	}
+	ctx.Writer.WriteHeader(http.StatusNoContent)
+	return MessageNoContent
+}
+
+// create creates an upload, a body of application/offset+octet-stream
+// is written as the first chunk
+func (s *TusServer) create(ctx *Context) interface{} {
+	var (
+		err    error
+		random [16]byte
+		upload *TusUpload = &TusUpload{}
+	)
+
+	if result := s.begin(ctx); result != nil {
+		return result
+	}
+
+	if upload.Length, err = strconv.ParseInt(ctx.Request.Header.Get("Upload-Length"), 10, 64); err != nil || upload.Length < 0 {
+		return ctx.BadRequest(&Error{Description: invalidUploadLength})
+	}
+	if s.opt.MaxSize > 0 && upload.Length > s.opt.MaxSize {
+		return ctx.renderError(http.StatusText(http.StatusRequestEntityTooLarge),
+			&Error{Description: fmt.Sprintf(fileTooLarge, s.opt.MaxSize)}, http.StatusRequestEntityTooLarge)
+	}
+	if upload.Metadata, err = parseTusMetadata(ctx.Request.Header.Get("Upload-Metadata")); err != nil {
+		return ctx.BadRequest(err)
+	}
+
+	if _, err = rand.Read(random[:]); err != nil {
+		return ctx.InternalServerError(DescError(err))
+	}
+	upload.ID = hex.EncodeToString(random[:])
+	upload.Name = path.Join(cleanName(s.opt.Dir), upload.ID)
+	s.touch(upload)
+
+	if _, err = s.opt.Storage.Put(ctx.requestContext(), upload.Name, bytes.NewReader(nil)); err != nil {
+		return ctx.InternalServerError(DescError(err))
+	}
+	if err = s.save(ctx.requestContext(), upload); err != nil {
+		return ctx.InternalServerError(DescError(err))
+	}
+
+	ctx.Writer.Header().Set("Location", strings.TrimSuffix(ctx.Request.URL.Path, "/")+"/"+upload.ID)
+
+	if ctx.Request.Header.Get(contentType) == tusContentType || upload.Length == 0 {
+		return s.write(ctx, upload, http.StatusCreated)
+	}
+
+	s.headers(ctx, upload)
+	ctx.Writer.WriteHeader(http.StatusCreated)
+	return upload
+}
+
+// head returns the offset of an upload
+func (s *TusServer) head(ctx *Context) interface{} {
+	var (
+		err    error
+		upload *TusUpload
+		result interface{}
+	)
+
+	if result = s.begin(ctx); result != nil {
+		return result
+	}
+	if upload, result = s.load(ctx); result != nil {
+		return result
+	}
+
+	// retry OnComplete unless a PATCH is running it
+	if !upload.Completed && upload.Offset == upload.Length && s.lock(ctx.Vars[id]) {
+		defer s.unlock(ctx.Vars[id])
+
+		// a PATCH may have completed it meanwhile
+		if upload, result = s.load(ctx); result != nil {
+			return result
+		}
+		if err = s.complete(ctx, upload); err != nil {
+			return ctx.InternalServerError(DescError(err))
+		}
+	}
+
+	s.headers(ctx, upload)
+	ctx.Writer.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		ctx.Writer.Header().Set("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+	ctx.Writer.Header().Set("Cache-Control", "no-store")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	return upload
+}
+
+// patch writes a chunk at Upload-Offset
+func (s *TusServer) patch(ctx *Context) interface{} {
+	var (
+		err    error
+		offset int64
+		upload *TusUpload
+		result interface{}
+	)
+
+	if result = s.begin(ctx); result != nil {
+		return result
+	}
+
+	if ctx.Request.Header.Get(contentType) != tusContentType {
+		return ctx.renderError(http.StatusText(http.StatusUnsupportedMediaType),
+			&Error{Description: invalidContentType}, http.StatusUnsupportedMediaType)
+	}
+	if offset, err = strconv.ParseInt(ctx.Request.Header.Get("Upload-Offset"), 10, 64); err != nil || offset < 0 {
+		return ctx.BadRequest(&Error{Description: invalidUploadOffset})
+	}
+
+	if !s.lock(ctx.Vars[id]) {
+		return ctx.renderError(http.StatusText(http.StatusLocked), &Error{Description: uploadLocked}, http.StatusLocked)
+	}
+	defer s.unlock(ctx.Vars[id])
+
+	if upload, result = s.load(ctx); result != nil {
+		return result
+	}
+
+	if offset != upload.Offset {
+		return ctx.renderError(MessageConflict, &Error{Description: fmt.Sprintf(offsetMismatch, upload.Offset)}, http.StatusConflict)
+	}
+
+	// nothing left to write, OnComplete may have failed before
+	if upload.Offset == upload.Length {
+		if err = s.complete(ctx, upload); err != nil {
+			return ctx.InternalServerError(DescError(err))
+		}
+		s.headers(ctx, upload)
+		ctx.Writer.WriteHeader(http.StatusNoContent)
+		return upload
+	}
+
+	return s.write(ctx, upload, http.StatusNoContent)
+}
+
+// terminate deletes an upload
+func (s *TusServer) terminate(ctx *Context) interface{} {
+	var (
+		err    error
+		upload *TusUpload
+		result interface{}
+	)
+
+	if result = s.begin(ctx); result != nil {
+		return result
+	}
+
+	if !s.lock(ctx.Vars[id]) {
+		return ctx.renderError(http.StatusText(http.StatusLocked), &Error{Description: uploadLocked}, http.StatusLocked)
+	}
+	defer s.unlock(ctx.Vars[id])
+
+	if upload, result = s.load(ctx); result != nil {
+		return result
+	}
+	if err = s.remove(ctx.requestContext(), upload); err != nil {
+		return ctx.InternalServerError(DescError(err))
+	}
+
+	ctx.Writer.WriteHeader(http.StatusNoContent)
+	return MessageDeleted
+}
+
+// write appends the request body to upload and answers with status.
+// The offset is saved even if the body ends early or the client goes
+// away, otherwise the next chunk would be appended after stray bytes.
+func (s *TusServer) write(ctx *Context, upload *TusUpload, status int) interface{} {
+	var (
+		err      error
+		written  int64
+		complete bool
+		limited  *limitedReader = &limitedReader{
+			r:   ctx.Request.Body,
+			max: upload.Length - upload.Offset,
+		}
+	)
+
+	if ctx.Request.ContentLength > limited.max {
+		return ctx.renderError(http.StatusText(http.StatusRequestEntityTooLarge),
+			&Error{Description: chunkTooLarge}, http.StatusRequestEntityTooLarge)
+	}
+
+	written, err = s.opt.Storage.Append(ctx.requestContext(), upload.Name, limited)
+	upload.Offset += written
+	complete = upload.Offset == upload.Length
+	s.touch(upload)
+
+	// the appended bytes are stored whether the client is still there or not
+	if saveErr := s.save(context.Background(), upload); saveErr != nil {
+		return ctx.InternalServerError(DescError(saveErr))
+	}
+
+	if err != nil && !limited.exceeded() {
+		return ctx.InternalServerError(DescError(err))
+	}
+
+	// a body longer than Upload-Length still completes the upload
+	if complete {
+		if err = s.complete(ctx, upload); err != nil {
+			return ctx.InternalServerError(DescError(err))
+		}
+	}
+
+	if limited.exceeded() {
+		return ctx.renderError(http.StatusText(http.StatusRequestEntityTooLarge),
+			&Error{Description: chunkTooLarge}, http.StatusRequestEntityTooLarge)
+	}
+
+	s.headers(ctx, upload)
+	ctx.Writer.WriteHeader(status)
+	return upload
+}
+
+// complete calls OnComplete on a fully written upload and marks it
+// completed, an upload which is not completed keeps its expiration
+func (s *TusServer) complete(ctx *Context, upload *TusUpload) error {
+	if upload.Completed || upload.Offset != upload.Length {
+		return nil
+	}
+
+	if s.opt.OnComplete != nil {
+		if err := s.opt.OnComplete(ctx, upload); err != nil {
+			return err
+		}
+	}
+
+	// OnComplete has run, record it even if the client is gone
+	upload.Completed = true
+	upload.ExpiresAt = nil
+	return s.save(context.Background(), upload)
+}
+
+// begin sets Tus-Resumable and checks the protocol version of the
+// request. A non nil result means the response has been sent.
+func (s *TusServer) begin(ctx *Context) interface{} {
+	ctx.Writer.Header().Set("Tus-Resumable", tusVersion)
+
+	if ctx.Request.Header.Get("Tus-Resumable") != tusVersion {
+		ctx.Writer.Header().Set("Tus-Version", tusVersion)
+		return ctx.renderError(http.StatusText(http.StatusPreconditionFailed),
+			&Error{Description: unsupportedTusVersion}, http.StatusPreconditionFailed)
+	}
+	return nil
+}
+
+// headers sets offset and expiration headers of upload
+func (s *TusServer) headers(ctx *Context, upload *TusUpload) {
+	ctx.Writer.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.ExpiresAt != nil {
+		ctx.Writer.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// touch moves the expiration of upload
+func (s *TusServer) touch(upload *TusUpload) {
+	if s.opt.Expiration > 0 {
+		expiresAt := time.Now().Add(s.opt.Expiration)
+		upload.ExpiresAt = &expiresAt
+	}
+}
+
+// lock reserves upload id for a single request, false if another
+// request holds it. Only uploads being written are kept in memory.
+func (s *TusServer) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+// unlock releases upload id reserved by lock
+func (s *TusServer) unlock(id string) {
+	s.mu.Lock()
+	delete(s.busy, id)
+	s.mu.Unlock()
+}
+
+// load reads the upload of the route, a missing upload is answered
+// with 404 and an expired one is removed and answered with 410.
+// A non nil result means the response has been sent.
+func (s *TusServer) load(ctx *Context) (*TusUpload, interface{}) {
+	var (
+		err    error
+		upload *TusUpload
+	)
+
+	if upload, err = s.read(ctx.requestContext(), path.Join(cleanName(s.opt.Dir), ctx.Vars[id])); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ctx.NotFound()
+		}
+		return nil, ctx.InternalServerError(DescError(err))
+	}
+
+	if upload.expired() {
+		s.remove(ctx.requestContext(), upload)
+		return nil, ctx.renderError(http.StatusText(http.StatusGone), &Error{Description: uploadExpired}, http.StatusGone)
+	}
+
+	return upload, nil
+}
+
+// read reads the state of upload name
+func (s *TusServer) read(ctx context.Context, name string) (*TusUpload, error) {
+	var (
+		err    error
+		reader io.ReadCloser
+		upload *TusUpload = &TusUpload{Name: name}
+	)
+
+	if reader, err = s.opt.Storage.Open(ctx, name+tusInfoSuffix); err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if err = json.NewDecoder(reader).Decode(upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// save writes the state of upload next to its data
+func (s *TusServer) save(ctx context.Context, upload *TusUpload) error {
+	var (
+		err  error
+		info []byte
+	)
+
+	if info, err = json.Marshal(upload); err != nil {
+		return err
+	}
+	_, err = s.opt.Storage.Put(ctx, upload.Name+tusInfoSuffix, bytes.NewReader(info))
+	return err
+}
+
+// remove deletes the data and the state of upload
+func (s *TusServer) remove(ctx context.Context, upload *TusUpload) error {
+	if err := s.opt.Storage.Delete(ctx, upload.Name); err != nil {
+		return err
+	}
+	return s.opt.Storage.Delete(ctx, upload.Name+tusInfoSuffix)
+}
+
+// expired returns true if upload has passed its expiration
+func (u *TusUpload) expired() bool {
+	return u.ExpiresAt != nil && time.Now().After(*u.ExpiresAt)
+}
+
+// tusIDPattern matches the id of an upload, see tusID
+var tusIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// parseTusMetadata parses Upload-Metadata, comma separated
+// pairs of key and base64 encoded value
+func parseTusMetadata(header string) (map[string]string, error) {
+	var (
+		err      error
+		pair     string
+		fields   []string
+		value    []byte
+		metadata map[string]string = make(map[string]string)
+	)
+
+	for _, pair = range strings.Split(header, ",") {
+		if fields = strings.Fields(pair); len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, &Error{Description: invalidUploadMetadata}
+		}
+		if len(fields) == 2 {
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, &Error{Description: invalidUploadMetadata}
+			}
+		} else {
+			value = nil
+		}
+		metadata[fields[0]] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// formatTusMetadata formats metadata as Upload-Metadata
+func formatTusMetadata(metadata map[string]string) string {
+	var (
+		key   string
+		value string
+		pairs []string
+	)
+
+	for key, value = range metadata {
+		if value == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	return strings.Join(pairs, ",")
+}
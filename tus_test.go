@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// droppedBody yields data then cancels the request as
+// a client does when its connection breaks
+type droppedBody struct {
+	data   io.Reader
+	cancel context.CancelFunc
+}
+
+// Read implements io.Reader Read
+func (b *droppedBody) Read(p []byte) (int, error) {
+	if n, err := b.data.Read(p); n > 0 || err != io.EOF {
+		return n, err
+	}
+	b.cancel()
+	return 0, io.ErrUnexpectedEOF
+}
+
+// tusRequest sends a tus request to router
+func tusRequest(router http.Handler, request *http.Request, headers map[string]string) *httptest.ResponseRecorder {
+	var w *httptest.ResponseRecorder = httptest.NewRecorder()
+
+	request.Header.Set("Tus-Resumable", tusVersion)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	router.ServeHTTP(w, request)
+	return w
+}
+
+func TestTusCancelledPatch(t *testing.T) {
+	var (
+		ctx     *Context       = New()
+		storage *MemoryStorage = NewMemoryStorage()
+		data    string         = "hello, resumable world"
+		w       *httptest.ResponseRecorder
+	)
+
+	ctx.Tus("/files", NewTusOptions(storage))
+
+	w = tusRequest(ctx.Router, httptest.NewRequest(http.MethodPost, "/files", nil),
+		map[string]string{"Upload-Length": "22"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, want %d", w.Code, http.StatusCreated)
+	}
+	location := w.Header().Get("Location")
+
+	// the client goes away after the first 5 bytes
+	requestCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request := httptest.NewRequest(http.MethodPatch, location, &droppedBody{strings.NewReader(data[:5]), cancel})
+	tusRequest(ctx.Router, request.WithContext(requestCtx), map[string]string{
+		"Content-Type":  tusContentType,
+		"Upload-Offset": "0",
+	})
+
+	w = tusRequest(ctx.Router, httptest.NewRequest(http.MethodHead, location, nil), nil)
+	if offset := w.Header().Get("Upload-Offset"); offset != "5" {
+		t.Fatalf("offset after cancelled patch is %q, want %q", offset, "5")
+	}
+
+	w = tusRequest(ctx.Router, httptest.NewRequest(http.MethodPatch, location, strings.NewReader(data[5:])),
+		map[string]string{"Content-Type": tusContentType, "Upload-Offset": "5"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("resume: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	reader, err := storage.Open(context.Background(), strings.TrimPrefix(location, "/files/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if stored, _ := io.ReadAll(reader); string(stored) != data {
+		t.Errorf("stored %q, want %q", stored, data)
+	}
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -11,15 +14,24 @@ import (
 type (
 	// Response struct hold default server response
 	Response struct {
-		Message string      `json:"message"`
-		Data    interface{} `json:"data"`
+		XMLName xml.Name    `json:"-" xml:"response" msgpack:"-"`
+		Message string      `json:"message" xml:"message"`
+		Data    interface{} `json:"data" xml:"data"`
 	}
 
 	// Error inherits error interface
 	Error struct {
 		error
-		Description string `json:"description"`
-		Errors      error  `json:"error,omitempty"`
+		Description string       `json:"description"`
+		Errors      error        `json:"error,omitempty" xml:"-"`
+		Fields      []FieldError `json:"fields,omitempty"`
+	}
+
+	// FieldError describes a single failing field of validation.Errors
+	FieldError struct {
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
 	}
 
 	// Validator interface
@@ -27,6 +39,14 @@ type (
 		Validate() error
 	}
 
+	// BindOptions configure Context.BindWith
+	BindOptions struct {
+		// MaxBodySize limits request body in bytes, zero means no limit
+		MaxBodySize int64
+		// DisallowUnknownFields rejects fields that do not exist in dst
+		DisallowUnknownFields bool
+	}
+
 	// URLQuery struct for server side rendering
 	URLQuery struct {
 		ItemsPerPage string `schema:"items_per_page" json:"items_per_page"`
@@ -34,17 +54,47 @@ type (
 		Keyword      string `schema:"keyword" json:"keyword,omitempty"`
 		StartDate    string `schema:"start_date" json:"start_date,omitempty"`
 		EndDate      string `schema:"end_date" json:"end_date,omitempty"`
-		OrderBy      string `schema:"order_by" json:"order_by"`
-		Descending   string `schema:"descending" json:"descending"`
+		// Sort lists sort keys, a "-" prefix sorts descending
+		Sort string `schema:"sort" json:"sort,omitempty"`
+		// Deprecated: OrderBy is not used, use Sort.
+		OrderBy string `schema:"order_by" json:"order_by"`
+		// Deprecated: Descending only applies to FilteredColumn OrderBy
+		// when Sort is empty, use Sort.
+		Descending string `schema:"descending" json:"descending"`
+		Cursor     string `schema:"cursor" json:"cursor,omitempty"`
+		Count      string `schema:"count" json:"count,omitempty"`
+		// TimeZone of start and end date, e.g. Asia/Jakarta,
+		// default is UTC or the zone set by SetLocation
+		TimeZone string `schema:"tz" json:"tz,omitempty"`
+		// Filters are parsed from filter[field][operator] parameters
+		Filters []Filter `schema:"-" json:"filters,omitempty"`
 	}
 
 	// FilteredColumn filter columns for paginations
 	FilteredColumn struct {
+		// OrderBy is the default order when sort is not requested
 		OrderBy        string
 		DateColumn     string
 		KeywordColumns []string
+		// DefaultToday filters DateColumn by today when
+		// start and end date are not requested
+		DefaultToday bool
+		// PrimaryKey breaks ties of the sort in cursor pagination,
+		// default is "id"
+		PrimaryKey string
+		// Sorts whitelists keys of the sort parameter
+		Sorts map[string]SortColumn
+		// KeywordMatch sets match mode of keyword columns,
+		// columns which are not listed use MatchContains
+		KeywordMatch map[string]KeywordMatch
+		// Filters whitelists fields of filter[field][operator]
+		Filters map[string]FilterColumn
 	}
 
+	// KeywordMatch is how a keyword column matches the keyword,
+	// MatchInsensitive may be combined, e.g. MatchPrefix | MatchInsensitive
+	KeywordMatch int
+
 	// PaginationResult for server side rendering
 	PaginationResult struct {
 		List         interface{} `json:"list"`
@@ -55,6 +105,29 @@ type (
 		TotalPage    int64       `json:"total_pages"`
 		StartDate    *time.Time  `json:"start_date,omitempty"`
 		EndDate      *time.Time  `json:"end_date,omitempty"`
+		DateRange    *DateRange  `json:"date_range,omitempty"`
+	}
+
+	// CursorPaginationResult for cursor pagination, TotalItems
+	// is only set when count=true is requested
+	CursorPaginationResult struct {
+		List         interface{} `json:"list"`
+		Keyword      string      `json:"keyword,omitempty"`
+		ItemsPerPage int         `json:"items_per_page"`
+		NextCursor   string      `json:"next_cursor,omitempty"`
+		PrevCursor   string      `json:"prev_cursor,omitempty"`
+		TotalItems   *int64      `json:"total_items,omitempty"`
+		StartDate    *time.Time  `json:"start_date,omitempty"`
+		EndDate      *time.Time  `json:"end_date,omitempty"`
+		DateRange    *DateRange  `json:"date_range,omitempty"`
+	}
+
+	// DateRange is the half-open range [Start, End) of the date filter
+	// in TimeZone, Start is nil when the range has no start
+	DateRange struct {
+		Start    *time.Time `json:"start,omitempty"`
+		End      *time.Time `json:"end"`
+		TimeZone string     `json:"tz"`
 	}
 
 	// gormv1Config struct for database connection
@@ -68,6 +141,26 @@ type (
 		connectionString string
 	}
 
+	// ServerOptions holds http.Server settings used by ServeWithOptions
+	// and ServeTLS. Zero ReadHeaderTimeout and IdleTimeout use the
+	// defaults of NewServerOptions.
+	ServerOptions struct {
+		ReadTimeout        time.Duration
+		ReadHeaderTimeout  time.Duration
+		WriteTimeout       time.Duration
+		IdleTimeout        time.Duration
+		MaxHeaderBytes     int
+		TLSConfig          *tls.Config
+		CertReloadInterval time.Duration
+	}
+
+	// RecoverOptions configure RecoverWith middleware
+	RecoverOptions struct {
+		// ShowPanic sends the panic value as response data
+		// when DEBUG_MODE is on
+		ShowPanic bool
+	}
+
 	// RedisOptions inherits redis.Options
 	RedisOptions struct {
 		redis.Options
@@ -84,7 +177,7 @@ type (
 		ID        uint           `gorm:"primarykey" json:"id"`
 		CreatedAt time.Time      `json:"created_at"`
 		UpdatedAt time.Time      `json:"updated_at"`
-		DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+		DeletedAt gorm.DeletedAt `gorm:"index" json:"-" xml:"-"`
 	}
 
 	// GormDB type of gormdb
@@ -96,13 +189,29 @@ func (e *Error) Error() string {
 	return e.Description
 }
 
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Errors
+}
+
 // Validate implements Validatior Validate
 func (u URLQuery) Validate() error {
 	return validation.ValidateStruct(&u,
 		validation.Field(&u.ItemsPerPage, isNumeric),
 		validation.Field(&u.Page, isNumeric),
-		validation.Field(&u.Keyword, isAlphaNum),
+		validation.Field(&u.Keyword, validation.RuneLength(0, maxKeywordLength)),
 		validation.Field(&u.StartDate, isDate),
-		validation.Field(&u.EndDate, isDate),
+		validation.Field(&u.EndDate, isDate, validation.By(u.notBeforeStart)),
+		validation.Field(&u.TimeZone, validation.By(validTimeZone)),
+		validation.Field(&u.Count, validation.In(logicalTrue, "false")),
 	)
 }
+
+// notBeforeStart checks end date is not before StartDate,
+// both are compared as dates 2006-01-02
+func (u URLQuery) notBeforeStart(value interface{}) error {
+	if end, _ := value.(string); end != "" && u.StartDate != "" && end < u.StartDate {
+		return errors.New(endBeforeStart)
+	}
+	return nil
+}
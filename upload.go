@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type (
+	// UploadOptions configure Context.SaveUpload
+	UploadOptions struct {
+		// Storage persists the file, it is required
+		Storage Storage
+		// MaxSize limits the file in bytes, zero means no limit
+		MaxSize int64
+		// AllowedTypes lists media types detected from the content
+		// like "image/png" or "image/*", empty allows any type
+		AllowedTypes []string
+		// Dir is prepended to the generated file name
+		Dir string
+	}
+
+	// Upload is the metadata of a saved file, it can be stored with gorm
+	Upload struct {
+		Model
+		Name         string `gorm:"size:255;uniqueIndex" json:"name"`
+		OriginalName string `gorm:"size:255" json:"original_name"`
+		ContentType  string `gorm:"size:127" json:"content_type"`
+		Size         int64  `json:"size"`
+		Checksum     string `gorm:"size:64" json:"checksum"`
+	}
+
+	// limitedReader fails once more than max bytes are read,
+	// the bytes past max are never returned
+	limitedReader struct {
+		r    io.Reader
+		max  int64
+		read int64
+	}
+)
+
+// NewUploadOptions returns default UploadOptions of storage,
+// files are limited to 10MB
+func NewUploadOptions(storage Storage) *UploadOptions {
+	return &UploadOptions{
+		Storage: storage,
+		MaxSize: defaultMaxMemory,
+	}
+}
+
+// SaveUpload streams the file of field into opt.Storage under a random
+// name and returns its metadata. The media type is detected from the
+// content, not from the client. On failure it sends 400-bad request
+// (or 500 when the storage fails) and returns the error, see BindWith.
+//
+// If the multipart form has not been parsed the body is read as a stream,
+// only the form values sent before the file are then available in PostForm.
+func (c *Context) SaveUpload(field string, opt *UploadOptions) (*Upload, error) {
+	var (
+		err    error
+		file   io.ReadCloser
+		header *multipart.FileHeader
+		upload *Upload
+	)
+
+	if opt == nil || opt.Storage == nil {
+		err = &Error{Description: storageNotSet}
+		c.InternalServerError(err)
+		return nil, err
+	}
+
+	if c.Request.MultipartForm != nil {
+		var part multipart.File
+		if part, header, err = c.Request.FormFile(field); err == nil {
+			file = part
+		}
+	} else {
+		file, header, err = c.multipartFile(field)
+	}
+
+	if err != nil {
+		if err == http.ErrMissingFile {
+			err = validation.Errors{field: errors.New(fileRequired)}
+		}
+		err = DescError(err)
+		c.BadRequest(err)
+		return nil, err
+	}
+	defer file.Close()
+
+	if upload, err = saveFile(c.requestContext(), file, header.Filename, field, opt); err != nil {
+		err = DescError(err)
+		if FieldErrors(err) != nil {
+			c.BadRequest(err)
+		} else {
+			c.InternalServerError(err)
+		}
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// multipartFile reads the multipart body until the file part of field,
+// preceding form values are stored in PostForm
+func (c *Context) multipartFile(field string) (io.ReadCloser, *multipart.FileHeader, error) {
+	var (
+		err    error
+		reader *multipart.Reader
+		part   *multipart.Part
+		value  bytes.Buffer
+		size   int64
+	)
+
+	if reader, err = c.Request.MultipartReader(); err != nil {
+		return nil, nil, err
+	}
+
+	if c.Request.PostForm == nil {
+		c.Request.PostForm = make(url.Values)
+	}
+
+	for {
+		if part, err = reader.NextPart(); err != nil {
+			if err == io.EOF {
+				return nil, nil, http.ErrMissingFile
+			}
+			return nil, nil, err
+		}
+
+		if part.FormName() == field && part.FileName() != "" {
+			return part, &multipart.FileHeader{Filename: part.FileName(), Header: part.Header}, nil
+		}
+
+		if part.FileName() != "" {
+			continue
+		}
+
+		// keep form values within the memory limit
+		value.Reset()
+		if size, err = io.CopyN(&value, part, defaultMaxMemory+1); err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if size > defaultMaxMemory {
+			return nil, nil, multipart.ErrMessageTooLarge
+		}
+		c.Request.PostForm.Add(part.FormName(), value.String())
+	}
+}
+
+// saveFile checks the content of file and puts it into opt.Storage.
+// Validation errors are returned as validation.Errors of field.
+func saveFile(ctx context.Context, file io.Reader, originalName, field string, opt *UploadOptions) (*Upload, error) {
+	var (
+		err     error
+		n       int
+		head    [512]byte
+		checker hash.Hash = sha256.New()
+		limited *limitedReader
+		upload  *Upload = &Upload{
+			OriginalName: filepath.Base(filepath.FromSlash(strings.ReplaceAll(originalName, `\`, "/"))),
+		}
+	)
+
+	if n, err = io.ReadFull(file, head[:]); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, validation.Errors{field: errors.New(emptyFile)}
+	}
+
+	upload.ContentType = http.DetectContentType(head[:n])
+	if !allowedType(upload.ContentType, opt.AllowedTypes) {
+		return nil, validation.Errors{field: fmt.Errorf(fileTypeNotAllowed, upload.ContentType)}
+	}
+
+	if upload.Name, err = randomName(opt.Dir, upload.OriginalName, upload.ContentType); err != nil {
+		return nil, err
+	}
+
+	limited = &limitedReader{r: io.MultiReader(bytes.NewReader(head[:n]), file), max: opt.MaxSize}
+	if upload.Size, err = opt.Storage.Put(ctx, upload.Name, io.TeeReader(limited, checker)); err != nil {
+		opt.Storage.Delete(ctx, upload.Name)
+		if limited.exceeded() {
+			return nil, validation.Errors{field: fmt.Errorf(fileTooLarge, opt.MaxSize)}
+		}
+		return nil, err
+	}
+
+	upload.Checksum = hex.EncodeToString(checker.Sum(nil))
+	return upload, nil
+}
+
+// allowedType returns true if mediaType matches one of allowed,
+// "type/*" matches any subtype
+func allowedType(mediaType string, allowed []string) bool {
+	var pattern string
+
+	if len(allowed) == 0 {
+		return true
+	}
+
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = parsed
+	}
+
+	for _, pattern = range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*/*" || pattern == mediaType ||
+			(strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomName returns a random file name in dir. The extension of
+// originalName is kept only if it belongs to mediaType.
+func randomName(dir, originalName, mediaType string) (string, error) {
+	var (
+		err        error
+		random     [16]byte
+		ext        string
+		extensions []string
+	)
+
+	if _, err = rand.Read(random[:]); err != nil {
+		return "", err
+	}
+
+	extensions, _ = mime.ExtensionsByType(mediaType)
+	for _, candidate := range extensions {
+		if strings.EqualFold(candidate, filepath.Ext(originalName)) {
+			ext = candidate
+			break
+		}
+	}
+	if ext == "" && len(extensions) > 0 {
+		ext = extensions[0]
+	}
+
+	return path.Join(cleanName(dir), hex.EncodeToString(random[:])+strings.ToLower(ext)), nil
+}
+
+// Read implements io.Reader Read
+func (r *limitedReader) Read(p []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	// read at most one byte past max to detect it
+	if r.max > 0 && int64(len(p)) > r.max-r.read+1 {
+		p = p[:r.max-r.read+1]
+	}
+
+	n, err = r.r.Read(p)
+	r.read += int64(n)
+	if r.exceeded() {
+		return n - int(r.read-r.max), &Error{Description: fmt.Sprintf(fileTooLarge, r.max)}
+	}
+	return n, err
+}
+
+// exceeded returns true if more than max bytes have been read
+func (r *limitedReader) exceeded() bool {
+	return r.max > 0 && r.read > r.max
+}
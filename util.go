@@ -7,11 +7,13 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"net/http"
 	"net/url"
 
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
@@ -31,7 +33,11 @@ type RestHandlers interface {
 	reset(http.ResponseWriter, *http.Request)
 }
 
-// REST maps router to appropriate methods
+// RestFactory returns a new RestHandlers instance
+type RestFactory func() RestHandlers
+
+// REST maps router to appropriate methods.
+// rest must not be shared between requests, see Context.RESTFactory
 func REST(rest RestHandlers, ctx *Context) interface{} {
 	id, withid := mux.Vars(ctx.Request)[id]
 
@@ -47,7 +53,7 @@ func REST(rest RestHandlers, ctx *Context) interface{} {
 			return rest.Put()
 		case patch:
 			return rest.Patch()
-		case delete:
+		case methodDelete:
 			return rest.Delete()
 		}
 	} else { // route to /{id:[0-9]+}
@@ -58,7 +64,7 @@ func REST(rest RestHandlers, ctx *Context) interface{} {
 			return rest.PutID(id)
 		case patch:
 			return rest.PatchID(id)
-		case delete:
+		case methodDelete:
 			return rest.DeleteID(id)
 		}
 	}
@@ -66,23 +72,46 @@ func REST(rest RestHandlers, ctx *Context) interface{} {
 	return ctx.MethodNotAllowed()
 }
 
-// errorImage render an error image and send it as response
-func errorImage(w http.ResponseWriter) interface{} {
-	// check for ERROR_IMAGE. If it exist return default
-	// no image file insted of 404-not found
-	file, err := os.Open(os.Getenv("ERROR_IMAGE"))
-	if err != nil {
-		return response(w, "No image", nil, http.StatusNotFound)
+// errorImage sends the image of ERROR_IMAGE env, if it does not exist
+// a 404-not found is sent instead. r may be nil.
+func errorImage(w http.ResponseWriter, r *http.Request) interface{} {
+	var (
+		err       error
+		file      *os.File
+		info      os.FileInfo
+		mediaType string
+	)
+
+	if file, info, mediaType, err = openFile(os.Getenv("ERROR_IMAGE")); err != nil {
+		return errorRenderer(w, r, "No image", nil, http.StatusNotFound)
 	}
 	defer file.Close()
-	return WriteImage(os.Getenv("ERROR_IMAGE"), w)
+
+	if r == nil {
+		r = &http.Request{Method: get, Header: make(http.Header)}
+	}
+
+	// the fallback must not be cached as the requested image,
+	// without validators conditional requests are ignored
+	w.Header().Set(contentType, mediaType)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	setImageHeaders(w)
+
+	http.ServeContent(w, r, info.Name(), time.Time{}, file)
+	return "send error image: " + info.Name()
 }
 
-// WriteImage send response as an image
+// WriteImage send response as an image.
+//
+// Deprecated: WriteImage re-encodes the image and supports only JPEG and
+// PNG, use Context.SendImage or Context.SendFile instead.
 func WriteImage(path string, w http.ResponseWriter) error {
 	// inner function for failure action
 	fail := func(err error) error {
-		errorImage(w)
+		errorImage(w, nil)
 		Logger(err)
 		return DescError(err)
 	}
@@ -129,8 +158,7 @@ func WriteImage(path string, w http.ResponseWriter) error {
 		return fail(err)
 	}
 
-	w.Header().Set("Strict-Transport-Security", "max-age=31536000")
-	w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	setImageHeaders(w)
 
 	w.WriteHeader(http.StatusOK)
 
@@ -142,34 +170,61 @@ func WriteImage(path string, w http.ResponseWriter) error {
 }
 
 // FormData parse the incoming POST body into struct
-// only handle application/json and application/x-www-form-urlencoded
+// handle application/json, application/x-www-form-urlencoded
+// and multipart/form-data. Returns decode error if any.
 func FormData(form interface{}, r *http.Request) error {
+	var err error
+	if err = decodeBody(form, r, &BindOptions{}); err != nil {
+		Logger(err)
+	}
+	return err
+}
+
+// decodeBody decodes body of r into form according to its content type
+func decodeBody(form interface{}, r *http.Request, opt *BindOptions) error {
 	var (
-		err           error
-		contentType   string
-		jsonDecoder   *json.Decoder
-		schemaDecoder *schema.Decoder
+		err               error
+		headerContentType string
+		jsonDecoder       *json.Decoder
+		schemaDecoder     *schema.Decoder
 	)
-	contentType = r.Header.Get(contentType)
 
-	if strings.Contains(contentType, "application/json") {
+	headerContentType = r.Header.Get(contentType)
+	schemaDecoder = schema.NewDecoder()
+	schemaDecoder.IgnoreUnknownKeys(!opt.DisallowUnknownFields)
+
+	switch {
+	case strings.Contains(headerContentType, "application/json"):
 		jsonDecoder = json.NewDecoder(r.Body)
-		jsonDecoder.Decode(form)
-	} else if strings.Contains(contentType, "application/x-www-form-urlencoded") {
-		r.ParseForm()
-		schemaDecoder = schema.NewDecoder()
-		schemaDecoder.Decode(form, r.Form)
-	} else if strings.Contains(contentType, "multipart/form-data") {
-		r.ParseMultipartForm(10 << 20)
-		schemaDecoder = schema.NewDecoder()
-		schemaDecoder.Decode(form, r.Form)
-	} else {
-		err = &Error{
-			Description: invalidContentType,
+		if opt.DisallowUnknownFields {
+			jsonDecoder.DisallowUnknownFields()
 		}
-		Logger(err)
+		if err = jsonDecoder.Decode(form); err == io.EOF {
+			return &Error{Description: emptyBody}
+		}
+	case strings.Contains(headerContentType, "application/x-www-form-urlencoded"):
+		if err = r.ParseForm(); err == nil {
+			err = schemaDecoder.Decode(form, r.Form)
+		}
+	case strings.Contains(headerContentType, "multipart/form-data"):
+		if err = r.ParseMultipartForm(defaultMaxMemory); err == nil {
+			err = schemaDecoder.Decode(form, r.Form)
+		}
+	default:
+		return &Error{Description: invalidContentType}
 	}
-	return err
+
+	if err != nil {
+		return DescError(err)
+	}
+	return nil
+}
+
+// exceedsMaxBytes returns true if err comes from reading past the limit
+// of http.MaxBytesReader. http.MaxBytesError needs go 1.19 so the error
+// is recognized by its message, which parsers may wrap.
+func exceedsMaxBytes(err error) bool {
+	return strings.Contains(err.Error(), maxBytesExceeded)
 }
 
 // DecodeURLQuery parse the incoming URL query into struct Urlq.
@@ -178,7 +233,10 @@ func DecodeURLQuery(w http.ResponseWriter, v url.Values) (args URLQuery, err err
 	// get url's query
 	decoder := schema.NewDecoder()
 	decoder.Decode(&args, v)
-	if err := args.Validate(); err != nil {
+	if err = args.Validate(); err != nil {
+		return args, DescError(err)
+	}
+	if args.Filters, err = parseFilters(v); err != nil {
 		return args, DescError(err)
 	}
 
@@ -187,53 +245,78 @@ func DecodeURLQuery(w http.ResponseWriter, v url.Values) (args URLQuery, err err
 
 // Write custom message response
 func Write(w http.ResponseWriter, message string, data interface{}, status int) interface{} {
-	return response(w, message, data, status)
+	return response(w, nil, message, data, status)
+}
+
+// isDebugMode returns true if DEBUG_MODE is set to true or 1
+func isDebugMode() bool {
+	var debug string = strings.ToLower(os.Getenv("DEBUG_MODE"))
+	return debug == logicalTrue || debug == "1"
 }
 
 // DescError returns handler.Error struct with generated
-// string err.Error() as its description
+// string err.Error() as its description. Fields lists each
+// failing field if err holds validation.Errors.
 func DescError(err error) *Error {
+	// already described
+	if custError, ok := err.(*Error); ok {
+		return custError
+	}
+
 	return &Error{
 		Description: err.Error(),
 		Errors:      err,
+		Fields:      FieldErrors(err),
 	}
 }
 
-// response returns JSON encoded data
-func response(w http.ResponseWriter, message string, data interface{}, status int) interface{} {
+// response encodes data within the request Envelope using the renderer
+// negotiated from Accept header of r or the Content-Type already set on w.
+// Without suitable renderer data is written as plain text.
+func response(w http.ResponseWriter, r *http.Request, message string, data interface{}, status int) interface{} {
 	var (
-		response            Response
-		responseContentType string
-		jsonEncoder         *json.Encoder
+		err          error
+		ok           bool
+		buffer       bytes.Buffer
+		renderer     Renderer
+		dataRenderer DataRenderer
+		payload      interface{}
 	)
 
-	responseContentType = w.Header().Get(contentType)
+	// never write a response twice
+	if isWritten(w) {
+		Logger(ErrAlreadyWritten)
+		return ErrAlreadyWritten
+	}
 
-	if strings.Contains(responseContentType, "application/json") {
-		// write collected headers with status
-		w.WriteHeader(status)
+	payload = envelopeOf(r)(message, status, data, r)
 
-		// encode data to json format
-		jsonEncoder = json.NewEncoder(w)
-		response = Response{Message: message, Data: data}
-		jsonEncoder.Encode(response)
-	} else {
-		var (
-			buffer bytes.Buffer
-			err    error
-		)
+	if r != nil {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	if renderer = negotiate(w, r); renderer == nil {
 		_, err = fmt.Fprintf(&buffer, "%+v", data)
+	} else if dataRenderer, ok = renderer.(DataRenderer); ok {
+		w.Header().Set(contentType, renderer.ContentType())
+		err = dataRenderer.RenderData(&buffer, data)
+	} else {
+		w.Header().Set(contentType, renderer.ContentType())
+		err = renderer.Render(&buffer, payload)
+	}
 
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Something went wrong!"))
-		} else {
-			w.WriteHeader(status)
-			w.Write(buffer.Bytes())
-		}
+	if err != nil {
+		Logger(DescError(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Something went wrong!"))
+	} else {
+		// write collected headers with status
+		w.WriteHeader(status)
+		w.Write(buffer.Bytes())
 	}
+
 	// write log
-	Logger(response)
+	Logger(Response{Message: message, Data: data})
 
 	// return data
 	return data
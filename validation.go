@@ -1,14 +1,101 @@
 package handler
 
 import (
+	"errors"
 	"regexp"
+	"sort"
+	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
 // these variable should be constant
 var (
-	isNumeric  = validation.Match(regexp.MustCompile("^[0-9]+$"))
-	isAlphaNum = validation.Match(regexp.MustCompile("^[a-zA-Z0-9\\s.]+$"))
-	isDate     = validation.Date("2006-01-02")
+	isNumeric = validation.Match(regexp.MustCompile("^[0-9]+$"))
+	isDate    = validation.Date("2006-01-02")
 )
+
+// validationCodes maps ozzo-validation messages to error codes
+var validationCodes = []struct {
+	prefix string
+	code   string
+}{
+	{"cannot be blank", "required"},
+	{"is required", "required"},
+	{"must be blank", "blank"},
+	{"must be in a valid format", "format"},
+	{"must be a valid date", "date"},
+	{"the data is out of range", "date_range"},
+	{"must be a valid value", "in"},
+	{"must not be in list", "not_in"},
+	{"the length must", "length"},
+	{"must be no less than", "min"},
+	{"must be no greater than", "max"},
+	{"must be multiple of", "multiple_of"},
+	{"must be either a string or byte slice", "type"},
+}
+
+// errorCode returns machine-readable code of a field error.
+// err may implement Code() string to set its own code.
+func errorCode(err error) string {
+	var (
+		message string
+		coder   interface{ Code() string }
+	)
+
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+
+	message = err.Error()
+	for _, rule := range validationCodes {
+		if strings.HasPrefix(message, rule.prefix) {
+			return rule.code
+		}
+	}
+	return "invalid"
+}
+
+// FieldErrors flattens validation.Errors found in err into FieldError
+// sorted by field. Nested fields are joined by dot. Returns nil if err
+// does not hold validation.Errors.
+func FieldErrors(err error) []FieldError {
+	var errs validation.Errors
+
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	return appendFieldErrors(nil, "", errs)
+}
+
+func appendFieldErrors(fields []FieldError, prefix string, errs validation.Errors) []FieldError {
+	var (
+		keys   []string
+		key    string
+		nested validation.Errors
+	)
+
+	for key = range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key = range keys {
+		if errs[key] == nil {
+			continue
+		}
+
+		if errors.As(errs[key], &nested) {
+			fields = appendFieldErrors(fields, prefix+key+".", nested)
+			continue
+		}
+
+		fields = append(fields, FieldError{
+			Field:   prefix + key,
+			Code:    errorCode(errs[key]),
+			Message: errs[key].Error(),
+		})
+	}
+
+	return fields
+}
@@ -1,41 +1,127 @@
 package handler
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // private constants
 const (
-	formatDate              string = "2006-01-02"
-	formatDateYMD           string = "20060102"
-	contentType             string = "Content-Type"
-	contentLength           string = "Content-Length"
-	imageJPG                string = "image/jpeg"
-	imagePNG                string = "image/png"
-	invalidContentType      string = "Invalid content type or the request contains empty body"
-	invalidDateFormat       string = "Invalid date format"
-	decodeFail              string = "Unable to decode file content. The file format is not in jpg neither png"
-	noImagePath             string = "assets/no-image.png"
-	contentSecurityPolicy   string = "Content-Security-Policy"
-	strictTransportSecurity string = "Strict-Transport-Security"
+	formatDate                string = "2006-01-02"
+	formatDateYMD             string = "20060102"
+	contentType               string = "Content-Type"
+	contentLength             string = "Content-Length"
+	problemJSON               string = "application/problem+json"
+	problemTypeBlank          string = "about:blank"
+	imageJPG                  string = "image/jpeg"
+	imagePNG                  string = "image/png"
+	invalidContentType        string = "Invalid content type or the request contains empty body"
+	emptyBody                 string = "Request body is empty"
+	bodyTooLarge              string = "Request body must be no greater than %d bytes"
+	maxBytesExceeded          string = "http: request body too large"
+	errSuperfluousWriteHeader string = "Superfluous WriteHeader call, response has already been written"
+	invalidDateFormat         string = "Invalid date format"
+	decodeFail                string = "Unable to decode file content. The file format is not in jpg neither png"
+	imageTooLarge             string = "Image of %dx%d pixels is too large to be transformed"
+	resultTooLarge            string = "results in %dx%d pixels which exceeds the limits"
+	storageNotSet             string = "Upload storage is not set"
+	modelNotSet               string = "Stream model is not set"
+	invalidFileName           string = "Invalid file name"
+	fileRequired              string = "cannot be blank"
+	emptyFile                 string = "must not be empty"
+	fileTypeNotAllowed        string = "file type %s is not allowed"
+	fileTooLarge              string = "must be no greater than %d bytes"
+	tusVersion                string = "1.0.0"
+	tusExtensions             string = "creation,creation-with-upload,expiration,termination"
+	tusContentType            string = "application/offset+octet-stream"
+	tusInfoSuffix             string = ".info"
+	unsupportedTusVersion     string = "Unsupported Tus-Resumable version, expected 1.0.0"
+	invalidUploadLength       string = "Invalid Upload-Length header"
+	invalidUploadOffset       string = "Invalid Upload-Offset header"
+	invalidUploadMetadata     string = "Invalid Upload-Metadata header"
+	offsetMismatch            string = "Upload-Offset does not match the current offset %d"
+	chunkTooLarge             string = "Chunk exceeds Upload-Length"
+	uploadLocked              string = "Upload is being written by another request"
+	uploadExpired             string = "Upload has expired"
+	invalidCursor             string = "must be a valid cursor"
+	cursorTotalKey            string = "handler:cursor_total"
+	invalidFilter             string = "must be filter[field] or filter[field][operator]"
+	filterNotAllowed          string = "is not a filterable field"
+	filterOperatorNotAllowed  string = "operator %s is not allowed"
+	invalidFilterNumber       string = "must be a number"
+	invalidFilterBool         string = "must be true or false"
+	invalidFilterTime         string = "must be a date (2006-01-02) or an RFC3339 time"
+	tooManyFilterValues       string = "must have at most %d values"
+	sortNotAllowed            string = "%q is not a sortable key"
+	duplicateSortKey          string = "must not repeat a key"
+	tooManySortKeys           string = "must have at most %d keys"
+	invalidTimeZone           string = "must be a valid time zone"
+	endBeforeStart            string = "must not be before start date"
+	dateRangeKey              string = "handler:date_range"
+	streamingUnsupported      string = "Streaming is not supported by the response writer"
+	noImagePath               string = "assets/no-image.png"
+	contentSecurityPolicy     string = "Content-Security-Policy"
+	strictTransportSecurity   string = "Strict-Transport-Security"
 
 	index string = ""
 	subID string = "/{id}"
+	tusID string = "/{id:[0-9a-f]{32}}"
 
 	id          string = "id"
 	restful     string = "rest"
 	logicalTrue string = "true"
 
-	get    string = http.MethodGet
-	post   string = http.MethodPost
-	put    string = http.MethodPut
-	patch  string = http.MethodPatch
-	delete string = http.MethodDelete
+	xmlRoot  string = "response"
+	xmlItem  string = "item"
+	xmlEntry string = "entry"
+	xmlKey   string = "key"
+
+	get          string = http.MethodGet
+	post         string = http.MethodPost
+	put          string = http.MethodPut
+	patch        string = http.MethodPatch
+	methodDelete string = http.MethodDelete
 
 	// 10MB
 	defaultMaxMemory int64 = 10 << 20
+
+	maxKeywordLength int    = 100
+	maxFilterValues  int    = 100
+	maxSortKeys      int    = 10
+	likeEscape       string = "!"
+
+	defaultShutdownTimeout    time.Duration = 15 * time.Second
+	defaultReadHeaderTimeout  time.Duration = 10 * time.Second
+	defaultIdleTimeout        time.Duration = 120 * time.Second
+	defaultCertReloadInterval time.Duration = time.Minute
+	defaultSSEHeartbeat       time.Duration = 15 * time.Second
+	defaultWSPongWait         time.Duration = 60 * time.Second
+	defaultWSWriteWait        time.Duration = 10 * time.Second
+	defaultTusExpiration      time.Duration = 24 * time.Hour
+
+	// 64KB
+	defaultWSReadLimit int64 = 64 << 10
+
+	defaultStreamFlushEvery int = 100
+	defaultImageMaxSize     int = 4096
+	defaultImageMaxPixels   int = 25000000
+	defaultImageQuality     int = 85
 )
 
 // exported constants
 const (
+	// MatchContains matches columns containing the keyword
+	MatchContains KeywordMatch = 0
+
+	// MatchPrefix matches columns starting with the keyword
+	MatchPrefix KeywordMatch = 1
+
+	// MatchExact matches columns equal to the keyword
+	MatchExact KeywordMatch = 2
+
+	// MatchInsensitive ignores case, ILIKE is used on postgres
+	MatchInsensitive KeywordMatch = 4
+
 	// MessageOK holds default message for Status Code 200
 	MessageOK = "OK"
 
@@ -72,6 +158,9 @@ const (
 	// MessageConflict holds default message for Status Code 409
 	MessageConflict = "Conflict"
 
+	// MessageUnprocessableEntity holds default message for Status Code 422
+	MessageUnprocessableEntity = "Unprocessable entity"
+
 	// MessageInternalServerError holds default message for Status Code 500
 	MessageInternalServerError = "Internal server error"
 
@@ -105,16 +194,28 @@ var (
 	errUnauthorized Error = Error{
 		Description: MessageUnauthorized,
 	}
+	errUnprocessableEntity Error = Error{
+		Description: MessageUnprocessableEntity,
+	}
 	errInternalServerError Error = Error{
 		Description: MessageInternalServerError,
 	}
 	errNotAllowed Error = Error{
 		Description: MessageMethodNotAllowed,
 	}
+	errStreamClosed Error = Error{
+		Description: "Stream is closed",
+	}
 )
 
 // public variables
 var (
-	indexMethods []string = []string{get, post, put, delete, patch}
-	subIDMethods []string = []string{get, put, patch, delete}
+	// ErrAlreadyWritten is returned by the response helpers of
+	// Context when the response has already been written
+	ErrAlreadyWritten = &Error{
+		Description: "Response has already been written",
+	}
+
+	indexMethods []string = []string{get, post, put, methodDelete, patch}
+	subIDMethods []string = []string{get, put, patch, methodDelete}
 )
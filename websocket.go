@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+type (
+	// WSOptions configure Context.WSWith
+	WSOptions struct {
+		// ReadLimit is the maximum size of an incoming message in bytes
+		ReadLimit int64
+		// PingInterval is the interval of ping messages,
+		// it must be less than PongWait
+		PingInterval time.Duration
+		// PongWait is how long to wait for a pong before
+		// the connection is considered dead
+		PongWait time.Duration
+		// WriteWait is the time allowed to write a message
+		WriteWait time.Duration
+		// AllowedOrigins lists origins allowed to connect like
+		// "https://example.com", "*" allows any origin. When empty
+		// and CheckOrigin is nil only the same origin is allowed.
+		AllowedOrigins []string
+		// CheckOrigin overrides AllowedOrigins
+		CheckOrigin     func(r *http.Request) bool
+		ReadBufferSize  int
+		WriteBufferSize int
+	}
+
+	// WSFunc handles a websocket connection, the connection
+	// is closed when the function returns
+	WSFunc func(*WSConn)
+
+	// WSConn is a websocket connection upgraded from Context.
+	// Writes are safe for concurrent use, reads are not.
+	WSConn struct {
+		Context *Context
+		Conn    *websocket.Conn
+		mu      sync.Mutex
+		once    sync.Once
+		done    chan struct{}
+		opt     *WSOptions
+	}
+
+	// Hub groups websocket connections into rooms for broadcasting.
+	// It is safe for concurrent use.
+	Hub struct {
+		mu    sync.RWMutex
+		rooms map[string]map[*WSConn]struct{}
+	}
+)
+
+// NewWSOptions returns default WSOptions, messages are limited
+// to 64KB and a ping is sent every 54 seconds
+func NewWSOptions() *WSOptions {
+	return &WSOptions{
+		ReadLimit:    defaultWSReadLimit,
+		PingInterval: defaultWSPongWait * 9 / 10,
+		PongWait:     defaultWSPongWait,
+		WriteWait:    defaultWSWriteWait,
+	}
+}
+
+// WS handle websocket connection on path with default WSOptions.
+// See WSWith.
+func (c *Context) WS(path string, fn WSFunc, middlewares ...mux.MiddlewareFunc) {
+	c.WSWith(path, nil, fn, middlewares...)
+}
+
+// WSWith handle websocket connection on path. The GET request is
+// upgraded then fn is called with the connection. Middlewares
+// only wrap this route, see GET.
+func (c *Context) WSWith(path string, opt *WSOptions, fn WSFunc, middlewares ...mux.MiddlewareFunc) {
+	var upgrader *websocket.Upgrader
+
+	if opt == nil {
+		opt = NewWSOptions()
+	}
+
+	upgrader = &websocket.Upgrader{
+		ReadBufferSize:  opt.ReadBufferSize,
+		WriteBufferSize: opt.WriteBufferSize,
+		CheckOrigin:     opt.checkOrigin(),
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			errorRenderer(w, r, http.StatusText(status), DescError(reason), status)
+		},
+	}
+
+	c.addRoute(get, path, func(ctx *Context) interface{} {
+		var (
+			err  error
+			conn *WSConn
+		)
+
+		if conn, err = ctx.upgrade(upgrader, opt); err != nil {
+			// upgrader has already sent the error response
+			return DescError(err)
+		}
+		defer conn.Close()
+
+		fn(conn)
+		return nil
+	}, middlewares)
+}
+
+// checkOrigin returns origin checker of AllowedOrigins,
+// nil lets the upgrader check for the same origin
+func (opt *WSOptions) checkOrigin() func(r *http.Request) bool {
+	if opt.CheckOrigin != nil {
+		return opt.CheckOrigin
+	}
+	if len(opt.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	return func(r *http.Request) bool {
+		var (
+			err     error
+			origin  *url.URL
+			allowed string
+		)
+
+		if r.Header.Get("Origin") == "" {
+			return true
+		}
+		if origin, err = url.Parse(r.Header.Get("Origin")); err != nil {
+			return false
+		}
+
+		for _, allowed = range opt.AllowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin.Scheme+"://"+origin.Host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// upgrade upgrades the request and starts the ping loop
+func (c *Context) upgrade(upgrader *websocket.Upgrader, opt *WSOptions) (*WSConn, error) {
+	var (
+		err  error
+		conn *WSConn = &WSConn{
+			Context: c,
+			done:    make(chan struct{}),
+			opt:     opt,
+		}
+	)
+
+	if conn.Conn, err = upgrader.Upgrade(c.Writer, c.Request, nil); err != nil {
+		return nil, err
+	}
+
+	if opt.ReadLimit > 0 {
+		conn.Conn.SetReadLimit(opt.ReadLimit)
+	}
+	if opt.PongWait > 0 {
+		conn.Conn.SetReadDeadline(time.Now().Add(opt.PongWait))
+		conn.Conn.SetPongHandler(func(string) error {
+			return conn.Conn.SetReadDeadline(time.Now().Add(opt.PongWait))
+		})
+	}
+	if opt.PingInterval > 0 {
+		go conn.ping()
+	}
+
+	return conn, nil
+}
+
+// ping sends ping messages until the connection is closed
+func (c *WSConn) ping() {
+	var ticker *time.Ticker = time.NewTicker(c.opt.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, c.deadline()); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// deadline returns write deadline of a message
+func (c *WSConn) deadline() time.Time {
+	if c.opt.WriteWait <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.opt.WriteWait)
+}
+
+// ReadJSON reads the next message and decodes it into v
+func (c *WSConn) ReadJSON(v interface{}) error {
+	return c.Conn.ReadJSON(v)
+}
+
+// WriteJSON encodes v and writes it as a text message
+func (c *WSConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Conn.SetWriteDeadline(c.deadline())
+	return c.Conn.WriteJSON(v)
+}
+
+// writePrepared writes a message prepared by Hub
+func (c *WSConn) writePrepared(message *websocket.PreparedMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Conn.SetWriteDeadline(c.deadline())
+	return c.Conn.WritePreparedMessage(message)
+}
+
+// Done is closed when the connection is closed
+func (c *WSConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close sends a normal closure message and closes the connection
+func (c *WSConn) Close() error {
+	var err error
+
+	c.once.Do(func() {
+		close(c.done)
+		c.Conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), c.deadline())
+		err = c.Conn.Close()
+	})
+
+	return err
+}
+
+// NewHub returns an empty Hub
+func NewHub() *Hub {
+	return &Hub{
+		rooms: make(map[string]map[*WSConn]struct{}),
+	}
+}
+
+// Join adds conn into room
+func (h *Hub) Join(room string, conn *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*WSConn]struct{})
+	}
+	h.rooms[room][conn] = struct{}{}
+}
+
+// Leave removes conn from room
+func (h *Hub) Leave(room string, conn *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.leave(room, conn)
+}
+
+// LeaveAll removes conn from every room
+func (h *Hub) LeaveAll(conn *WSConn) {
+	var room string
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for room = range h.rooms {
+		h.leave(room, conn)
+	}
+}
+
+// leave removes conn from room, an empty room is dropped
+func (h *Hub) leave(room string, conn *WSConn) {
+	delete(h.rooms[room], conn)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Count returns the number of connections in room
+func (h *Hub) Count(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Broadcast sends v as JSON to every connection in room.
+// Connections which fail to receive it are closed and removed.
+func (h *Hub) Broadcast(room string, v interface{}) error {
+	var (
+		err     error
+		message *websocket.PreparedMessage
+		members []*WSConn
+		conn    *WSConn
+		failed  []*WSConn
+	)
+
+	if message, err = prepareJSON(v); err != nil {
+		return DescError(err)
+	}
+
+	h.mu.RLock()
+	for conn = range h.rooms[room] {
+		members = append(members, conn)
+	}
+	h.mu.RUnlock()
+
+	for _, conn = range members {
+		if err = conn.writePrepared(message); err != nil {
+			failed = append(failed, conn)
+		}
+	}
+
+	for _, conn = range failed {
+		h.LeaveAll(conn)
+		conn.Close()
+	}
+
+	return nil
+}
+
+// prepareJSON encodes v as a text message ready to be sent to many connections
+func prepareJSON(v interface{}) (*websocket.PreparedMessage, error) {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = json.Marshal(v); err != nil {
+		return nil, err
+	}
+	return websocket.NewPreparedMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+type (
+	// ResponseWriter is a http.ResponseWriter which records
+	// the response state. Headers are only written once, a
+	// superfluous WriteHeader is ignored.
+	ResponseWriter interface {
+		http.ResponseWriter
+		http.Flusher
+		// Status returns the written status code or 0
+		Status() int
+		// Size returns the number of body bytes written
+		Size() int
+		// Written returns true once headers have been written
+		Written() bool
+	}
+
+	// responseWriter implements ResponseWriter
+	responseWriter struct {
+		http.ResponseWriter
+		status int
+		size   int
+	}
+)
+
+// WrapWriter returns w as ResponseWriter. If w is already wrapped it is
+// returned as is, so middlewares and Context share the same state, e.g.
+//
+//	rw := handler.WrapWriter(w)
+//	next.ServeHTTP(rw, r)
+//	log.Println(rw.Status(), rw.Size())
+func WrapWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+// isWritten returns true if w is a ResponseWriter already written
+func isWritten(w http.ResponseWriter) bool {
+	var rw, ok = w.(ResponseWriter)
+	return ok && rw.Written()
+}
+
+// canFlush returns true if the original writer of w supports http.Flusher
+func canFlush(w http.ResponseWriter) bool {
+	if rw, ok := w.(*responseWriter); ok {
+		return canFlush(rw.ResponseWriter)
+	}
+	_, ok := w.(http.Flusher)
+	return ok
+}
+
+// WriteHeader implements http.ResponseWriter WriteHeader
+func (w *responseWriter) WriteHeader(status int) {
+	if w.Written() {
+		Logger(&Error{Description: errSuperfluousWriteHeader})
+		return
+	}
+
+	// informational headers may precede the final one
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter Write
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.Written() {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Flush implements http.Flusher Flush
+func (w *responseWriter) Flush() {
+	if !w.Written() {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker Hijack
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the original http.ResponseWriter,
+// used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status implements ResponseWriter Status
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Size implements ResponseWriter Size
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+// Written implements ResponseWriter Written
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}